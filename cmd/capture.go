@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagCaptureLevel    string
+	flagCaptureDuration time.Duration
+	flagCaptureOutput   string
+)
+
+func init() {
+	rootCmd.AddCommand(captureCmd)
+	captureCmd.Flags().StringVarP(&flagCaptureLevel, "level", "l", "debug", "Comma-separated per-logger level during the capture, or named log profiles (see the profiles command)")
+	captureCmd.Flags().DurationVar(&flagCaptureDuration, "duration", time.Minute, "Duration of the capture window")
+	captureCmd.Flags().StringVarP(&flagCaptureOutput, "output", "o", "", "Path of the tar.gz bundle (default istiolog-capture-<time>.tar.gz)")
+	captureCmd.Flags().StringVar(&flagSelector, "selector", "", "Label selector of the pods to capture (e.g. app=checkout)")
+	captureCmd.Flags().BoolVar(&flagAll, "all", false, "Capture every pod with an istio-proxy container in the namespace")
+	captureCmd.Flags().BoolVar(&flagWaypoint, "waypoint", false, "Capture the waypoint of pods in ambient mode instead of the ztunnel of their node")
+}
+
+var captureCmd = &cobra.Command{
+	Args:  cobra.MaximumNArgs(1),
+	Use:   "capture [pod | type/name] [flags]",
+	Short: "captures a troubleshooting bundle of envoy logs and config",
+	Long: `Raises the log levels for the duration of the capture and writes a tar.gz
+bundle with, for every pod, the proxy logs over that window, the Envoy
+config_dump, clusters, stats, listeners and server_info before and after it,
+the pod spec and its events, along with a manifest. The levels are restored
+afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options, err := internal.GetOpts(config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		target := internal.Target{
+			Selector: flagSelector,
+			All:      flagAll,
+			Waypoint: flagWaypoint,
+		}
+		if len(args) > 0 {
+			target.Pod = args[0]
+		}
+		output := flagCaptureOutput
+		if output == "" {
+			output = fmt.Sprintf("istiolog-capture-%v.tar.gz", time.Now().Format("20060102-150405"))
+		}
+		err = options.KubectlIstioLogCapture(target, flagCaptureLevel, flagCaptureDuration, output)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
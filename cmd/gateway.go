@@ -0,0 +1,75 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(gatewayCmd)
+	gatewayCmd.Flags().StringVarP(&flagLogLevel, "level", "l", "warning", "Comma-separated minimum per-logger level of messages to output, or named log profiles (see the profiles command)")
+	gatewayCmd.Flags().BoolVarP(&flagFollow, "follow", "f", false, "Specify if the logs should be streamed")
+	gatewayCmd.Flags().DurationVar(&flagDuration, "duration", 0, "Revert the log levels after the given duration (e.g. 10m), recorded on the pods for the reap command")
+	gatewayCmd.Flags().StringVarP(&flagLogOutput, "output", "o", "raw", "Output format of the followed logs, one of raw, json or logfmt")
+	gatewayCmd.Flags().StringVar(&flagGrep, "grep", "", "Only print followed lines matching the regular expression")
+	gatewayCmd.Flags().StringVar(&flagExclude, "exclude", "", "Don't print followed lines matching the regular expression")
+	gatewayCmd.Flags().StringVar(&flagMinLevel, "min-level", "", "Only print followed lines at the given level or more severe")
+	gatewayCmd.Flags().StringSliceVar(&flagLoggers, "logger", nil, "Only print followed lines of the given comma-separated loggers (e.g. router,rbac)")
+	gatewayCmd.Flags().StringVar(&flagAccessLog, "access-log", "", "Only print access log entries meeting the comma-separated conditions (e.g. status>=500,flags=UH|UF,authority=reviews:9080), or all of them with \"all\"")
+	gatewayCmd.Flags().DurationVar(&flagSummary, "summary", 0, "Print the top failing routes and response flags of the access log at this interval while following (e.g. 30s)")
+	gatewayCmd.Flags().BoolVar(&flagStatsDiff, "stats-diff", false, "Print the Envoy counters that increased while following or until the levels are reverted, largest increase first")
+}
+
+var gatewayCmd = &cobra.Command{
+	Args:  cobra.MaximumNArgs(1),
+	Use:   "gateway [name] [flags]",
+	Short: "sets the log level of every replica of istio gateways",
+	Long: `Finds the pods of the gateway labeled istio=<name>, such as ingressgateway or
+egressgateway, or gateway.networking.k8s.io/gateway-name=<name> in every
+namespace, or in the one given with -n, and sets their log level. Without a
+name, the default ingress and egress gateways and every Gateway API gateway
+are targeted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options, err := internal.GetOpts(config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		var name string
+		if len(args) > 0 {
+			name = args[0]
+		}
+		stream := internal.StreamOptions{
+			Output:    flagLogOutput,
+			Grep:      flagGrep,
+			Exclude:   flagExclude,
+			MinLevel:  flagMinLevel,
+			Loggers:   flagLoggers,
+			AccessLog: flagAccessLog,
+			Summary:   flagSummary,
+			StatsDiff: flagStatsDiff,
+		}
+		allNamespaces := !cmd.Flags().Changed("namespace")
+		err = options.KubectlIstioLogGateway(name, allNamespaces, flagLogLevel, flagFollow, flagDuration, stream)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
@@ -0,0 +1,59 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var flagOutput string
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().StringVarP(&flagOutput, "output", "o", "table", "Output format, one of table, json or yaml")
+	getCmd.Flags().StringVar(&flagSelector, "selector", "", "Label selector of the pods to show (e.g. app=checkout)")
+	getCmd.Flags().BoolVar(&flagAll, "all", false, "Show every pod with an istio-proxy container in the namespace")
+	getCmd.Flags().BoolVar(&flagWaypoint, "waypoint", false, "Show the waypoint of pods in ambient mode instead of the ztunnel of their node")
+}
+
+var getCmd = &cobra.Command{
+	Args:  cobra.MaximumNArgs(1),
+	Use:   "get [pod | type/name] [flags]",
+	Short: "prints the current per-logger levels of envoy",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options, err := internal.GetOpts(config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		target := internal.Target{
+			Selector: flagSelector,
+			All:      flagAll,
+			Waypoint: flagWaypoint,
+		}
+		if len(args) > 0 {
+			target.Pod = args[0]
+		}
+		err = options.KubectlIstioLogGet(target, flagOutput)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
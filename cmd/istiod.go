@@ -0,0 +1,67 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagIstiodLevel    string
+	flagRevision       string
+	flagIstioNamespace string
+)
+
+func init() {
+	rootCmd.AddCommand(istiodCmd)
+	istiodCmd.Flags().StringVarP(&flagIstiodLevel, "level", "l", "", "Comma-separated per-scope level of istiod, in the form of [<scope>:]<level> (e.g. ads:debug,model:debug)")
+	istiodCmd.Flags().StringVarP(&flagRevision, "revision", "r", "", "Control plane revision of the istiod pods, all of them when empty")
+	istiodCmd.Flags().StringVarP(&flagIstioNamespace, "istio-namespace", "i", "istio-system", "Namespace of the istiod pods")
+	istiodCmd.Flags().StringVarP(&flagLogOutput, "output", "o", "raw", "Output format of the followed logs, one of raw, json or logfmt")
+	istiodCmd.Flags().StringVar(&flagGrep, "grep", "", "Only print followed lines matching the regular expression")
+	istiodCmd.Flags().StringVar(&flagExclude, "exclude", "", "Don't print followed lines matching the regular expression")
+	istiodCmd.Flags().StringVar(&flagMinLevel, "min-level", "", "Only print followed lines at the given level or more severe")
+	istiodCmd.MarkFlagRequired("level")
+}
+
+var istiodCmd = &cobra.Command{
+	Args:  cobra.NoArgs,
+	Use:   "istiod [flags]",
+	Short: "sets the log scopes of istiod and follows its logs",
+	Long: `Changes the levels of the log scopes of the istiod pods of a revision through
+ControlZ, follows the logs of their discovery container and reverts the levels
+on exit.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options, err := internal.GetOpts(config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		stream := internal.StreamOptions{
+			Output:   flagLogOutput,
+			Grep:     flagGrep,
+			Exclude:  flagExclude,
+			MinLevel: flagMinLevel,
+		}
+		err = options.KubectlIstioLogIstiod(flagRevision, flagIstioNamespace, flagIstiodLevel, stream)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
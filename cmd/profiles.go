@@ -0,0 +1,38 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(profilesCmd)
+}
+
+var profilesCmd = &cobra.Command{
+	Args:  cobra.NoArgs,
+	Use:   "profiles",
+	Short: "lists the named log profiles usable with --level",
+	Long: `Lists the built-in log profiles and the ones defined in
+~/.config/kubectl-istiolog/profiles.yaml, each a bundle of per-logger levels
+that can be passed to --level in place of a level, e.g. --level mtls.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := internal.KubectlIstioLogProfiles(); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
@@ -0,0 +1,46 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	internal "github.com/TejaBeta/kubectl-istiolog/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(reapCmd)
+}
+
+var reapCmd = &cobra.Command{
+	Args:  cobra.NoArgs,
+	Use:   "reap",
+	Short: "reverts every expired --duration log level in the cluster",
+	Long: `Finds the pods of every namespace whose log levels were raised with --duration
+and reverts the ones past their revert time to their original levels.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options, err := internal.GetOpts(config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = options.KubectlIstioLogReap()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
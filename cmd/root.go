@@ -16,35 +16,95 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	internal "github.com/TejaBeta/kubectl-istiolog/internal"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
-	flagVerbose   bool
-	flagNameSpace string
-	flagFollow    bool
-	flagLogLevel  string
+	flagVerbose    bool
+	flagKubeConfig string
+	flagFollow     bool
+	flagLogLevel   string
+	flagPaths      string
+	flagSelector   string
+	flagAll        bool
+	flagWaypoint   bool
+	flagDuration   time.Duration
+	flagLogOutput  string
+	flagGrep       string
+	flagExclude    string
+	flagMinLevel   string
+	flagLoggers    []string
+	flagAccessLog  string
+	flagSummary    time.Duration
+	flagRequestID  string
+	flagTraceID    string
+	flagPersist    bool
+	flagUnpersist  bool
+	flagYes        bool
+	flagDryRun     bool
+	flagStatsDiff  bool
+
+	kubeConfigOverrides = &clientcmd.ConfigOverrides{}
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Args:  cobra.MinimumNArgs(1),
-	Use:   "kubectl-istiolog [pod] [flags]",
+	Args:  cobra.MaximumNArgs(1),
+	Use:   "kubectl-istiolog [pod | type/name] [flags]",
 	Short: "A Kubectl plugin to manage and set envoy log levels",
 
 	Run: func(cmd *cobra.Command, args []string) {
-		context, err := internal.GetContext()
+		config, err := internal.GetClientConfig(flagKubeConfig, kubeConfigOverrides)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		options, err := internal.GetOpts(context, flagNameSpace)
+		options, err := internal.GetOpts(config)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		err = options.KubectlIstioLog(args[0], flagLogLevel, flagFollow)
+		target := internal.Target{
+			Selector: flagSelector,
+			All:      flagAll,
+			Waypoint: flagWaypoint,
+		}
+		if len(args) > 0 {
+			target.Pod = args[0]
+		}
+		logLevel, err := internal.LevelWithPaths(flagLogLevel, cmd.Flags().Changed("level"), flagPaths)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if flagDryRun {
+			if err := options.KubectlIstioLogDryRun(target, logLevel); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+		if flagPersist || flagUnpersist {
+			err = options.KubectlIstioLogPersist(target, logLevel, flagUnpersist, flagYes, os.Stdin, os.Stdout)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+		stream := internal.StreamOptions{
+			Output:    flagLogOutput,
+			Grep:      flagGrep,
+			Exclude:   flagExclude,
+			MinLevel:  flagMinLevel,
+			Loggers:   flagLoggers,
+			AccessLog: flagAccessLog,
+			Summary:   flagSummary,
+			RequestID: flagRequestID,
+			TraceID:   flagTraceID,
+			StatsDiff: flagStatsDiff,
+		}
+		err = options.KubectlIstioLog(target, logLevel, flagFollow, flagDuration, stream)
 		if err != nil {
 			panic(err)
 		}
@@ -52,7 +112,9 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	internal.CloseConnections()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -66,8 +128,30 @@ func init() {
 			log.SetLevel(log.WarnLevel)
 		}
 	})
-	rootCmd.Flags().BoolVar(&flagVerbose, "verbose", false, "Verbose mode on")
-	rootCmd.Flags().StringVarP(&flagNameSpace, "namespace", "n", "default", "Namespace in current context")
+	rootCmd.PersistentFlags().BoolVar(&flagVerbose, "verbose", false, "Verbose mode on")
+	rootCmd.PersistentFlags().StringVar(&flagKubeConfig, "kubeconfig", "", "Path to the kubeconfig file to use for CLI requests")
+	clientcmd.BindOverrideFlags(kubeConfigOverrides, rootCmd.PersistentFlags(), clientcmd.RecommendedConfigOverrideFlags(""))
 	rootCmd.Flags().BoolVarP(&flagFollow, "follow", "f", false, "Specify if the logs should be streamed")
-	rootCmd.Flags().StringVarP(&flagLogLevel, "level", "l", "warning", "Comma-separated minimum per-logger level of messages to output")
+	rootCmd.Flags().StringVarP(&flagLogLevel, "level", "l", "warning", "Comma-separated minimum per-logger level of messages to output, or named log profiles (see the profiles command)")
+	rootCmd.Flags().StringVar(&flagPaths, "paths", "", "Comma-separated source path glob:level pairs for proxies using fine-grain logging (e.g. source/common/http/*:debug)")
+	rootCmd.Flags().StringVar(&flagSelector, "selector", "", "Label selector of the pods to update (e.g. app=checkout)")
+	rootCmd.Flags().BoolVar(&flagAll, "all", false, "Update every pod with an istio-proxy container in the namespace")
+	rootCmd.Flags().BoolVar(&flagWaypoint, "waypoint", false, "Update the waypoint of pods in ambient mode instead of the ztunnel of their node")
+	rootCmd.Flags().StringVarP(&flagLogOutput, "output", "o", "raw", "Output format of the followed logs, one of raw, json or logfmt")
+	rootCmd.Flags().StringVar(&flagGrep, "grep", "", "Only print followed lines matching the regular expression")
+	rootCmd.Flags().StringVar(&flagExclude, "exclude", "", "Don't print followed lines matching the regular expression")
+	rootCmd.Flags().StringVar(&flagMinLevel, "min-level", "", "Only print followed lines at the given level or more severe")
+	rootCmd.Flags().StringSliceVar(&flagLoggers, "logger", nil, "Only print followed lines of the given comma-separated loggers (e.g. router,rbac)")
+	rootCmd.Flags().StringVar(&flagAccessLog, "access-log", "", "Only print access log entries meeting the comma-separated conditions (e.g. status>=500,flags=UH|UF,authority=reviews:9080), or all of them with \"all\"")
+	rootCmd.Flags().DurationVar(&flagSummary, "summary", 0, "Print the top failing routes and response flags of the access log at this interval while following (e.g. 30s)")
+	rootCmd.Flags().StringVar(&flagRequestID, "request-id", "", "Only print the followed lines of the request with this x-request-id, across every pod")
+	rootCmd.Flags().StringVar(&flagTraceID, "trace-id", "", "Only print the followed lines of the request with this trace id, across every pod")
+	rootCmd.Flags().BoolVar(&flagPersist, "persist", false, "Set the log levels on the pod template of the owning deployment or statefulset, which rolls it out")
+	rootCmd.Flags().BoolVar(&flagUnpersist, "unpersist", false, "Remove the log levels set with --persist from the pod template of the owning deployment or statefulset")
+	rootCmd.Flags().BoolVar(&flagYes, "yes", false, "Don't ask for confirmation before rolling out workloads with --persist or --unpersist")
+	rootCmd.Flags().BoolVar(&flagStatsDiff, "stats-diff", false, "Print the Envoy counters that increased while following or until the levels are reverted, largest increase first")
+	rootCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Print the per-logger changes of the log levels on every pod without applying them")
+	rootCmd.Flags().DurationVar(&flagDuration, "duration", 0, "Revert the log levels after the given duration (e.g. 10m), recorded on the pods for the reap command")
+	rootCmd.MarkFlagsMutuallyExclusive("persist", "unpersist", "follow", "duration")
+	rootCmd.MarkFlagsMutuallyExclusive("dry-run", "persist", "unpersist", "follow", "duration")
 }
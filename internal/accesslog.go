@@ -0,0 +1,415 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// accessLogEntry is an Envoy access log entry in Istio's default TEXT or JSON
+// encoding. Fields Envoy reports as "-" are left empty.
+type accessLogEntry struct {
+	StartTime                      string `json:"start_time,omitempty"`
+	Method                         string `json:"method,omitempty"`
+	Path                           string `json:"path,omitempty"`
+	Protocol                       string `json:"protocol,omitempty"`
+	ResponseCode                   int    `json:"response_code"`
+	ResponseFlags                  string `json:"response_flags,omitempty"`
+	ResponseCodeDetails            string `json:"response_code_details,omitempty"`
+	ConnectionTerminationDetails   string `json:"connection_termination_details,omitempty"`
+	UpstreamTransportFailureReason string `json:"upstream_transport_failure_reason,omitempty"`
+	BytesReceived                  int64  `json:"bytes_received"`
+	BytesSent                      int64  `json:"bytes_sent"`
+	Duration                       int64  `json:"duration"`
+	UpstreamServiceTime            string `json:"upstream_service_time,omitempty"`
+	XForwardedFor                  string `json:"x_forwarded_for,omitempty"`
+	UserAgent                      string `json:"user_agent,omitempty"`
+	RequestID                      string `json:"request_id,omitempty"`
+	Authority                      string `json:"authority,omitempty"`
+	UpstreamHost                   string `json:"upstream_host,omitempty"`
+	UpstreamCluster                string `json:"upstream_cluster,omitempty"`
+	UpstreamLocalAddress           string `json:"upstream_local_address,omitempty"`
+	DownstreamLocalAddress         string `json:"downstream_local_address,omitempty"`
+	DownstreamRemoteAddress        string `json:"downstream_remote_address,omitempty"`
+	RequestedServerName            string `json:"requested_server_name,omitempty"`
+	RouteName                      string `json:"route_name,omitempty"`
+}
+
+// The number of fields of Istio's default TEXT access log format, older
+// versions don't log the route name:
+//
+//	[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%"
+//	%RESPONSE_CODE% %RESPONSE_FLAGS% %RESPONSE_CODE_DETAILS%
+//	%CONNECTION_TERMINATION_DETAILS% "%UPSTREAM_TRANSPORT_FAILURE_REASON%"
+//	%BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)%
+//	"%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%"
+//	"%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" %UPSTREAM_CLUSTER%
+//	%UPSTREAM_LOCAL_ADDRESS% %DOWNSTREAM_LOCAL_ADDRESS%
+//	%DOWNSTREAM_REMOTE_ADDRESS% %REQUESTED_SERVER_NAME% %ROUTE_NAME%
+const textAccessLogFields = 22
+
+// parseAccessLog parses an access log entry in TEXT or JSON encoding
+func parseAccessLog(line string) (*accessLogEntry, bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONAccessLog(line)
+	}
+	if strings.HasPrefix(line, "[") {
+		return parseTextAccessLog(line)
+	}
+	return nil, false
+}
+
+func parseJSONAccessLog(line string) (*accessLogEntry, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil, false
+	}
+	if _, ok := fields["response_code"]; !ok {
+		return nil, false
+	}
+
+	str := func(key string) string {
+		switch v := fields[key].(type) {
+		case string:
+			if v == "-" {
+				return ""
+			}
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return ""
+		}
+	}
+	num := func(key string) int64 {
+		n, _ := strconv.ParseInt(str(key), 10, 64)
+		return n
+	}
+
+	return &accessLogEntry{
+		StartTime:                      str("start_time"),
+		Method:                         str("method"),
+		Path:                           str("path"),
+		Protocol:                       str("protocol"),
+		ResponseCode:                   int(num("response_code")),
+		ResponseFlags:                  str("response_flags"),
+		ResponseCodeDetails:            str("response_code_details"),
+		ConnectionTerminationDetails:   str("connection_termination_details"),
+		UpstreamTransportFailureReason: str("upstream_transport_failure_reason"),
+		BytesReceived:                  num("bytes_received"),
+		BytesSent:                      num("bytes_sent"),
+		Duration:                       num("duration"),
+		UpstreamServiceTime:            str("upstream_service_time"),
+		XForwardedFor:                  str("x_forwarded_for"),
+		UserAgent:                      str("user_agent"),
+		RequestID:                      str("request_id"),
+		Authority:                      str("authority"),
+		UpstreamHost:                   str("upstream_host"),
+		UpstreamCluster:                str("upstream_cluster"),
+		UpstreamLocalAddress:           str("upstream_local_address"),
+		DownstreamLocalAddress:         str("downstream_local_address"),
+		DownstreamRemoteAddress:        str("downstream_remote_address"),
+		RequestedServerName:            str("requested_server_name"),
+		RouteName:                      str("route_name"),
+	}, true
+}
+
+func parseTextAccessLog(line string) (*accessLogEntry, bool) {
+	fields, ok := splitAccessLogFields(line)
+	if !ok || len(fields) < textAccessLogFields-1 || len(fields) > textAccessLogFields {
+		return nil, false
+	}
+	if len(fields) < textAccessLogFields {
+		fields = append(fields, "")
+	}
+	for i, field := range fields {
+		if field == "-" {
+			fields[i] = ""
+		}
+	}
+
+	code, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, false
+	}
+	num := func(i int) int64 {
+		n, _ := strconv.ParseInt(fields[i], 10, 64)
+		return n
+	}
+
+	entry := &accessLogEntry{
+		StartTime:                      fields[0],
+		ResponseCode:                   code,
+		ResponseFlags:                  fields[3],
+		ResponseCodeDetails:            fields[4],
+		ConnectionTerminationDetails:   fields[5],
+		UpstreamTransportFailureReason: fields[6],
+		BytesReceived:                  num(7),
+		BytesSent:                      num(8),
+		Duration:                       num(9),
+		UpstreamServiceTime:            fields[10],
+		XForwardedFor:                  fields[11],
+		UserAgent:                      fields[12],
+		RequestID:                      fields[13],
+		Authority:                      fields[14],
+		UpstreamHost:                   fields[15],
+		UpstreamCluster:                fields[16],
+		UpstreamLocalAddress:           fields[17],
+		DownstreamLocalAddress:         fields[18],
+		DownstreamRemoteAddress:        fields[19],
+		RequestedServerName:            fields[20],
+		RouteName:                      fields[21],
+	}
+	// TCP entries log "- - -" as the request line
+	if request := strings.Fields(fields[1]); len(request) == 3 {
+		for i, field := range request {
+			if field == "-" {
+				request[i] = ""
+			}
+		}
+		entry.Method, entry.Path, entry.Protocol = request[0], request[1], request[2]
+	}
+	return entry, true
+}
+
+// splitAccessLogFields splits a TEXT access log line on spaces, keeping
+// "quoted" fields and the leading [start time] whole.
+func splitAccessLogFields(line string) ([]string, bool) {
+	end := strings.Index(line, "] ")
+	if !strings.HasPrefix(line, "[") || end < 0 {
+		return nil, false
+	}
+	fields := []string{line[1:end]}
+
+	rest := line[end+2:]
+	for rest != "" {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, false
+			}
+			fields = append(fields, rest[1:end+1])
+			rest = strings.TrimLeft(rest[end+2:], " ")
+			continue
+		}
+		field, next, _ := strings.Cut(rest, " ")
+		fields = append(fields, field)
+		rest = strings.TrimLeft(next, " ")
+	}
+	return fields, true
+}
+
+// failed reports whether the request failed, with a 5xx status or Envoy
+// response flags explaining why it didn't complete normally
+func (e *accessLogEntry) failed() bool {
+	return e.ResponseCode >= 500 || e.ResponseFlags != ""
+}
+
+// route names the route of the request for summaries
+func (e *accessLogEntry) route() string {
+	if e.RouteName != "" && e.RouteName != "default" {
+		return e.RouteName
+	}
+	path, _, _ := strings.Cut(e.Path, "?")
+	if e.Authority == "" && path == "" {
+		return e.UpstreamCluster
+	}
+	return e.Authority + path
+}
+
+func (e *accessLogEntry) responseFlags() []string {
+	if e.ResponseFlags == "" {
+		return nil
+	}
+	return strings.Split(e.ResponseFlags, ",")
+}
+
+// accessLogCondition is a single condition of an --access-log expression
+type accessLogCondition func(e *accessLogEntry) bool
+
+var accessLogConditionExpr = regexp.MustCompile(`^(\w+)\s*(>=|<=|!=|=~|=|>|<)\s*(.*)$`)
+
+// parseAccessLogFilter parses a comma-separated list of conditions all
+// entries must meet, such as status>=500,flags=UH|UF,authority=reviews:9080.
+// "all" matches every entry.
+func parseAccessLogFilter(expr string) ([]accessLogCondition, error) {
+	if strings.TrimSpace(expr) == "all" {
+		return []accessLogCondition{}, nil
+	}
+
+	var conditions []accessLogCondition
+	for _, term := range strings.Split(expr, ",") {
+		m := accessLogConditionExpr.FindStringSubmatch(strings.TrimSpace(term))
+		if m == nil {
+			return nil, fmt.Errorf("invalid --access-log condition: %q", term)
+		}
+		condition, err := newAccessLogCondition(m[1], m[2], m[3])
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func newAccessLogCondition(field, op, value string) (accessLogCondition, error) {
+	switch field {
+	case "status", "code":
+		expected, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --access-log status: %q", value)
+		}
+		compare, ok := map[string]func(int) bool{
+			"=":  func(code int) bool { return code == expected },
+			"!=": func(code int) bool { return code != expected },
+			">=": func(code int) bool { return code >= expected },
+			"<=": func(code int) bool { return code <= expected },
+			">":  func(code int) bool { return code > expected },
+			"<":  func(code int) bool { return code < expected },
+		}[op]
+		if !ok {
+			return nil, fmt.Errorf("invalid --access-log operator for %v: %v", field, op)
+		}
+		return func(e *accessLogEntry) bool { return compare(e.ResponseCode) }, nil
+	case "flags":
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("invalid --access-log operator for %v: %v", field, op)
+		}
+		expected := map[string]bool{}
+		for _, flag := range strings.Split(value, "|") {
+			expected[flag] = true
+		}
+		return func(e *accessLogEntry) bool {
+			for _, flag := range e.responseFlags() {
+				if expected[flag] {
+					return op == "="
+				}
+			}
+			return op == "!="
+		}, nil
+	}
+
+	get, ok := map[string]func(e *accessLogEntry) string{
+		"authority": func(e *accessLogEntry) string { return e.Authority },
+		"cluster":   func(e *accessLogEntry) string { return e.UpstreamCluster },
+		"route":     func(e *accessLogEntry) string { return e.RouteName },
+		"path":      func(e *accessLogEntry) string { return e.Path },
+		"method":    func(e *accessLogEntry) string { return e.Method },
+	}[field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported --access-log field: %v", field)
+	}
+	switch op {
+	case "=":
+		return func(e *accessLogEntry) bool { return get(e) == value }, nil
+	case "!=":
+		return func(e *accessLogEntry) bool { return get(e) != value }, nil
+	case "=~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --access-log expression for %v: %v", field, err)
+		}
+		return func(e *accessLogEntry) bool { return re.MatchString(get(e)) }, nil
+	default:
+		return nil, fmt.Errorf("invalid --access-log operator for %v: %v", field, op)
+	}
+}
+
+// accessLogSummary counts the failing requests by route and response flag
+// over an interval
+type accessLogSummary struct {
+	mu       sync.Mutex
+	requests int
+	failures int
+	routes   map[string]int
+	flags    map[string]int
+}
+
+func newAccessLogSummary() *accessLogSummary {
+	return &accessLogSummary{
+		routes: map[string]int{},
+		flags:  map[string]int{},
+	}
+}
+
+func (s *accessLogSummary) add(e *accessLogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if !e.failed() {
+		return
+	}
+	s.failures++
+	s.routes[e.route()]++
+	for _, flag := range e.responseFlags() {
+		s.flags[flag]++
+	}
+}
+
+const summaryTopCount = 5
+
+// print writes the top failing routes and response flags seen since the
+// last print, then starts counting over.
+func (s *accessLogSummary) print(out io.Writer, interval time.Duration) error {
+	s.mu.Lock()
+	requests, failures, routes, flags := s.requests, s.failures, s.routes, s.flags
+	s.requests, s.failures = 0, 0
+	s.routes, s.flags = map[string]int{}, map[string]int{}
+	s.mu.Unlock()
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "--- %d of %d requests failed in the last %v\n", failures, requests, interval)
+	if failures > 0 {
+		fmt.Fprintln(w, "ROUTE\tFAILURES")
+		for _, route := range topCounts(routes, summaryTopCount) {
+			fmt.Fprintf(w, "%v\t%d\n", route, routes[route])
+		}
+		if len(flags) > 0 {
+			fmt.Fprintln(w, "RESPONSE FLAG\tCOUNT")
+			for _, flag := range topCounts(flags, summaryTopCount) {
+				fmt.Fprintf(w, "%v\t%d\n", flag, flags[flag])
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// topCounts returns the n keys with the highest counts
+func topCounts(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
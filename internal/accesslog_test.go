@@ -0,0 +1,148 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testTextAccessLog = `[2023-08-01T10:00:00.600Z] "GET /reviews/0?x=1 HTTP/1.1" 503 UH,URX no_healthy_upstream - "-" 0 19 2 - "-" "curl/8.0" "6f0d3e6a-5e5a-9c4b-8d7b-0a5c1b2e3f4a" "reviews:9080" "-" outbound|9080||reviews.default.svc.cluster.local - 10.96.1.2:9080 10.244.0.5:51234 - default`
+	testTCPAccessLog  = `[2023-08-01T10:00:01.000Z] "- - -" 0 UF - - "-" 0 0 1 - "-" "-" "-" "-" "10.244.0.9:3306" outbound|3306||mysql.default.svc.cluster.local - 10.96.3.4:3306 10.244.0.5:40000 - -`
+	testJSONAccessLog = `{"authority":"ratings:9080","bytes_received":0,"bytes_sent":48,"duration":3,"method":"GET","path":"/ratings/0","protocol":"HTTP/1.1","request_id":"a1b2","response_code":200,"response_flags":"-","route_name":"default","start_time":"2023-08-01T10:00:02.000Z","upstream_cluster":"outbound|9080||ratings.default.svc.cluster.local","upstream_host":"10.244.0.7:9080"}`
+)
+
+func TestParseAccessLog_A001(t *testing.T) {
+	entry, ok := parseAccessLog(testTextAccessLog)
+	if !ok {
+		t.Fatal("Failed to parse TEXT access log entry")
+	}
+	if entry.Method != "GET" || entry.Path != "/reviews/0?x=1" || entry.ResponseCode != 503 ||
+		entry.ResponseFlags != "UH,URX" || entry.RequestID != "6f0d3e6a-5e5a-9c4b-8d7b-0a5c1b2e3f4a" ||
+		entry.Authority != "reviews:9080" || entry.UpstreamHost != "" ||
+		entry.UpstreamCluster != "outbound|9080||reviews.default.svc.cluster.local" ||
+		entry.BytesSent != 19 || entry.Duration != 2 || entry.RouteName != "default" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if entry.route() != "reviews:9080/reviews/0" {
+		t.Errorf("Unexpected route %v", entry.route())
+	}
+}
+
+func TestParseAccessLog_A002(t *testing.T) {
+	entry, ok := parseAccessLog(testTCPAccessLog)
+	if !ok {
+		t.Fatal("Failed to parse TCP access log entry")
+	}
+	if entry.Method != "" || entry.ResponseCode != 0 || entry.ResponseFlags != "UF" || entry.UpstreamHost != "10.244.0.9:3306" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	entry, ok = parseAccessLog(testJSONAccessLog)
+	if !ok {
+		t.Fatal("Failed to parse JSON access log entry")
+	}
+	if entry.ResponseCode != 200 || entry.ResponseFlags != "" || entry.Authority != "ratings:9080" || entry.BytesSent != 48 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	if _, ok := parseAccessLog(`{"level":"info"}`); ok {
+		t.Errorf("Error while parsing a JSON line that isn't an access log entry")
+	}
+}
+
+func TestAccessLogFilter_A001(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []int
+	}{
+		{"all", []int{0, 1, 2}},
+		{"status>=500", []int{0}},
+		{"flags=UH|UF", []int{0, 1}},
+		{"flags!=UF,status<300", []int{2}},
+		{"authority=reviews:9080", []int{0}},
+		{"cluster=~ratings|mysql", []int{1, 2}},
+	}
+	lines := []string{testTextAccessLog, testTCPAccessLog, testJSONAccessLog, "2023-08-01T10:00:00.500000Z\twarn\txdsproxy\tupstream terminated"}
+	for _, test := range tests {
+		filter, err := newLineFilter(StreamOptions{AccessLog: test.expr})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var matched []int
+		for i, line := range lines {
+			if filter.match(line, parseLogRecord(line)) {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) != len(test.expected) {
+			t.Errorf("--access-log %v matched %v, expected %v", test.expr, matched, test.expected)
+			continue
+		}
+		for i := range matched {
+			if matched[i] != test.expected[i] {
+				t.Errorf("--access-log %v matched %v, expected %v", test.expr, matched, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestAccessLogFilter_A002(t *testing.T) {
+	for _, expr := range []string{"status>=abc", "flags>UH", "upstream=x", "status"} {
+		if _, err := parseAccessLogFilter(expr); err == nil {
+			t.Errorf("Error while using illegal --access-log %v", expr)
+		}
+	}
+}
+
+func TestAccessLogSummary_A001(t *testing.T) {
+	summary := newAccessLogSummary()
+	for _, line := range []string{testTextAccessLog, testTextAccessLog, testTCPAccessLog, testJSONAccessLog} {
+		entry, _ := parseAccessLog(line)
+		summary.add(entry)
+	}
+
+	var out bytes.Buffer
+	if err := summary.print(&out, 30*time.Second); err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		"--- 3 of 4 requests failed in the last 30s",
+		"ROUTE",
+		"reviews:9080/reviews/0",
+		"outbound|3306||mysql.default.svc.cluster.local",
+		"RESPONSE FLAG",
+		"UH",
+		"URX",
+		"UF",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected summary %v", out.String())
+	}
+	for i := range expected {
+		if !strings.HasPrefix(lines[i], expected[i]) {
+			t.Errorf("Summary line %q, expected %q", lines[i], expected[i])
+		}
+	}
+
+	out.Reset()
+	summary.print(&out, 30*time.Second)
+	if strings.TrimSpace(out.String()) != "--- 0 of 0 requests failed in the last 30s" {
+		t.Errorf("Summary wasn't reset after printing: %v", out.String())
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/kube"
+)
+
+const (
+	// envoyAdminPort serves the admin API of Envoy, and the one of ztunnel
+	envoyAdminPort = 15000
+	// adminRequestTimeout bounds every admin request, so that a proxy that
+	// never answers can't hang the run, its revert on exit included
+	adminRequestTimeout = 30 * time.Second
+)
+
+// adminHTTPClient sends the admin requests
+var adminHTTPClient = &http.Client{Timeout: adminRequestTimeout}
+
+// Every request of a run to the admin API of a pod goes through the same
+// port forward, opened on first use with the Istio client shared by the run
+// and kept until CloseConnections.
+var adminConns = struct {
+	sync.Mutex
+	client kube.CLIClient
+	conns  map[string]*adminConn
+}{conns: map[string]*adminConn{}}
+
+// adminConn is the connection to an admin API of a pod. Its requests are
+// sent one at a time.
+type adminConn struct {
+	mu        sync.Mutex
+	api       string
+	pod       string
+	namespace string
+	port      int
+	forwarder kube.PortForwarder
+}
+
+// getAdminConn returns the connection to the admin API served on the port
+// of the pod, named api in errors
+func getAdminConn(api, pod, namespace string, port int) *adminConn {
+	adminConns.Lock()
+	defer adminConns.Unlock()
+
+	key := fmt.Sprintf("%v/%v:%d", namespace, pod, port)
+	conn, ok := adminConns.conns[key]
+	if !ok {
+		conn = &adminConn{api: api, pod: pod, namespace: namespace, port: port}
+		adminConns.conns[key] = conn
+	}
+	return conn
+}
+
+// istioClient returns the Istio client of the run, created on first use
+func istioClient() (kube.CLIClient, error) {
+	adminConns.Lock()
+	defer adminConns.Unlock()
+
+	if adminConns.client == nil {
+		client, err := kubeClient(clientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+		}
+		adminConns.client = client
+	}
+	return adminConns.client, nil
+}
+
+// CloseConnections closes the port forwards of the run. They are closed
+// once the pool is released, as a request still being sent holds its
+// connection while it may need the pool for the Istio client.
+func CloseConnections() {
+	adminConns.Lock()
+	conns := adminConns.conns
+	adminConns.conns = map[string]*adminConn{}
+	adminConns.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+	}
+}
+
+func (c *adminConn) start() error {
+	client, err := istioClient()
+	if err != nil {
+		return err
+	}
+	forwarder, err := client.NewPortForwarder(c.pod, c.namespace, "", 0, c.port)
+	if err != nil {
+		return fmt.Errorf("failed to execute command on %v: %v", c.api, err)
+	}
+	if err := forwarder.Start(); err != nil {
+		return fmt.Errorf("failed to execute command on %v: failed to port forward to %v: %v", c.api, c.pod, err)
+	}
+	c.forwarder = forwarder
+	return nil
+}
+
+func (c *adminConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.forwarder != nil {
+		c.forwarder.Close()
+		c.forwarder = nil
+	}
+}
+
+// do sends the request to the admin API. A port forward that dropped, for
+// instance while following the logs for long, is opened again once.
+func (c *adminConn) do(method, path string, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if c.forwarder == nil {
+			if err := c.start(); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequest(method, "http://"+c.forwarder.Address()+"/"+strings.TrimPrefix(path, "/"), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := adminHTTPClient.Do(req)
+		if err != nil {
+			c.forwarder.Close()
+			c.forwarder = nil
+			// A proxy that doesn't answer in time isn't waited for twice
+			var netErr net.Error
+			timeout := errors.As(err, &netErr) && netErr.Timeout()
+			if attempt == 0 && !timeout {
+				continue
+			}
+			return nil, fmt.Errorf("failed to execute command on %v: %v", c.api, err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			// Only the first line, Envoy follows it with its whole usage
+			message, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+			return nil, fmt.Errorf("failed to execute command on %v: %v %v returned %v: %v", c.api, method, path, resp.Status, message)
+		}
+		return data, nil
+	}
+}
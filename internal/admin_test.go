@@ -0,0 +1,214 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestIstioClient_A001(t *testing.T) {
+	previous := kubeClient
+	t.Cleanup(func() {
+		kubeClient = previous
+		adminConns.client = nil
+		CloseConnections()
+	})
+
+	created := 0
+	kubeClient = func(clientcmd.ClientConfig) (kube.CLIClient, error) {
+		created++
+		return kube.NewFakeClient(), nil
+	}
+	adminConns.client = nil
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := istioClient(); err != nil {
+				t.Error(err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Expected a single client for the run, got %d", created)
+	}
+}
+
+func TestGetAdminConn_A001(t *testing.T) {
+	t.Cleanup(CloseConnections)
+
+	conn := getAdminConn("Envoy", "reviews-1", "bookinfo", envoyAdminPort)
+	if getAdminConn("Envoy", "reviews-1", "bookinfo", envoyAdminPort) != conn {
+		t.Error("Expected the requests to the pod to share its connection")
+	}
+	if getAdminConn("Envoy", "reviews-2", "bookinfo", envoyAdminPort) == conn {
+		t.Error("Expected every pod to have its own connection")
+	}
+	if getAdminConn("ControlZ", "reviews-1", "bookinfo", controlzPort) == conn {
+		t.Error("Expected every admin port to have its own connection")
+	}
+
+	CloseConnections()
+	if getAdminConn("Envoy", "reviews-1", "bookinfo", envoyAdminPort) == conn {
+		t.Error("Expected closed connections to be dropped")
+	}
+}
+
+func TestForEachPod_A001(t *testing.T) {
+	pods := make([]corev1.Pod, 3*maxConcurrentPods)
+	for i := range pods {
+		pods[i] = corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "reviews-" + string(rune('a'+i))}}
+	}
+
+	var running, highest int32
+	visited := make([]string, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			h := atomic.LoadInt32(&highest)
+			if n <= h || atomic.CompareAndSwapInt32(&highest, h, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		visited[i] = pod.Name
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i, pod := range pods {
+		if visited[i] != pod.Name {
+			t.Errorf("Pod %v not visited", pod.Name)
+		}
+	}
+	if highest > maxConcurrentPods {
+		t.Errorf("Expected at most %d pods at once, got %d", maxConcurrentPods, highest)
+	}
+}
+
+// testForwarder forwards to a local address
+type testForwarder struct {
+	address string
+	closed  bool
+}
+
+func (f *testForwarder) Start() error    { return nil }
+func (f *testForwarder) Address() string { return f.address }
+func (f *testForwarder) Close()          { f.closed = true }
+func (f *testForwarder) WaitForStop()    {}
+
+func TestAdminConnDo_A001(t *testing.T) {
+	previous := adminHTTPClient
+	adminHTTPClient = &http.Client{Timeout: 100 * time.Millisecond}
+	t.Cleanup(func() { adminHTTPClient = previous })
+
+	// A proxy accepting the connection but never answering
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	forwarder := &testForwarder{address: strings.TrimPrefix(server.URL, "http://")}
+	conn := &adminConn{api: "Envoy", pod: "reviews-1", namespace: "bookinfo", port: envoyAdminPort, forwarder: forwarder}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.do("POST", "logging", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "failed to execute command on Envoy") {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request to a proxy that never answers didn't time out")
+	}
+	if !forwarder.closed || conn.forwarder != nil {
+		t.Error("Expected the port forward to the stuck proxy to be closed")
+	}
+
+	// Closing the connection doesn't wait on the stuck request any more
+	conn.close()
+}
+
+// testProxy serves the admin API of the pod with handler for the rest of the
+// test
+func testProxy(t *testing.T, pod, namespace string, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	conn := getAdminConn("Envoy", pod, namespace, envoyAdminPort)
+	conn.forwarder = &testForwarder{address: strings.TrimPrefix(server.URL, "http://")}
+	t.Cleanup(CloseConnections)
+}
+
+func TestCloseConnections_A001(t *testing.T) {
+	previous := kubeClient
+	t.Cleanup(func() {
+		kubeClient = previous
+		adminConns.client = nil
+	})
+	kubeClient = func(clientcmd.ClientConfig) (kube.CLIClient, error) {
+		return kube.NewFakeClient(), nil
+	}
+	adminConns.client = nil
+
+	forwarder := &testForwarder{}
+	conn := getAdminConn("Envoy", "reviews-1", "bookinfo", envoyAdminPort)
+	conn.forwarder = forwarder
+
+	// A request in flight holds its connection while closing waits for it
+	conn.mu.Lock()
+	closed := make(chan struct{})
+	go func() {
+		CloseConnections()
+		close(closed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The request may still need the pool to port forward again
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := istioClient()
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Error(err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Closing the connections blocked the pool")
+	}
+	conn.mu.Unlock()
+
+	<-closed
+	if !forwarder.closed {
+		t.Error("Expected the port forward to be closed")
+	}
+}
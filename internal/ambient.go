@@ -0,0 +1,236 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Pods in ambient mode have no sidecar. Their L4 traffic goes through the
+// ztunnel of their node and their L7 traffic through the waypoint of their
+// namespace, both of which run their proxy in an istio-proxy container.
+const (
+	ambientRedirectionAnnotation = "ambient.istio.io/redirection"
+	ztunnelLabel                 = "app"
+	ztunnelLabelValue            = "ztunnel"
+	useWaypointLabel             = "istio.io/use-waypoint"
+	useWaypointNamespaceLabel    = "istio.io/use-waypoint-namespace"
+	gatewayNameLabel             = "gateway.networking.k8s.io/gateway-name"
+)
+
+func isAmbient(pod corev1.Pod) bool {
+	return pod.Annotations[ambientRedirectionAnnotation] == "enabled"
+}
+
+func isZtunnel(pod corev1.Pod) bool {
+	return pod.Labels[ztunnelLabel] == ztunnelLabelValue
+}
+
+// ambientProxies replaces the ambient pods by the proxies handling their
+// traffic: the ztunnel of their node, or their waypoint when waypoint is set.
+// Proxies shared by several pods are only returned once.
+func (opts *options) ambientProxies(pods []corev1.Pod, waypoint bool) ([]corev1.Pod, error) {
+	var proxies []corev1.Pod
+	seen := map[string]bool{}
+	add := func(pod corev1.Pod) {
+		key := pod.Namespace + "/" + pod.Name
+		if !seen[key] {
+			seen[key] = true
+			proxies = append(proxies, pod)
+		}
+	}
+
+	for _, pod := range pods {
+		if hasIstioProxy(pod) || !isAmbient(pod) {
+			add(pod)
+			continue
+		}
+
+		var resolved []corev1.Pod
+		var err error
+		if waypoint {
+			resolved, err = opts.waypointPods(pod)
+		} else {
+			resolved, err = opts.ztunnelPods(pod)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, proxy := range resolved {
+			fmt.Fprintf(os.Stderr, "%v is in ambient mode, using %v/%v\n", pod.Name, proxy.Namespace, proxy.Name)
+			add(proxy)
+		}
+	}
+	return proxies, nil
+}
+
+// ztunnelPods returns the ztunnel running on the node of the pod
+func (opts *options) ztunnelPods(pod corev1.Pod) ([]corev1.Pod, error) {
+	if pod.Spec.NodeName == "" {
+		return nil, fmt.Errorf("%v isn't scheduled on a node yet", pod.Name)
+	}
+	result, err := opts.clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{ztunnelLabel: ztunnelLabelValue}).String(),
+		FieldSelector: "spec.nodeName=" + pod.Spec.NodeName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ztunnel := range result.Items {
+		if ztunnel.Spec.NodeName == pod.Spec.NodeName && ztunnel.DeletionTimestamp == nil {
+			return []corev1.Pod{ztunnel}, nil
+		}
+	}
+	return nil, fmt.Errorf("no ztunnel found on node %v of %v", pod.Spec.NodeName, pod.Name)
+}
+
+// waypointPods returns the pods of the waypoint used by the pod, as set by
+// the istio.io/use-waypoint label on the pod or its namespace
+func (opts *options) waypointPods(pod corev1.Pod) ([]corev1.Pod, error) {
+	name, namespace := pod.Labels[useWaypointLabel], pod.Labels[useWaypointNamespaceLabel]
+	if name == "" {
+		ns, err := opts.clientset.CoreV1().Namespaces().Get(context.TODO(), pod.Namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		name, namespace = ns.Labels[useWaypointLabel], ns.Labels[useWaypointNamespaceLabel]
+	}
+	if name == "" || name == "none" {
+		return nil, fmt.Errorf("%v doesn't use a waypoint", pod.Name)
+	}
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+
+	result, err := opts.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{gatewayNameLabel: name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, waypoint := range result.Items {
+		if waypoint.DeletionTimestamp == nil {
+			pods = append(pods, waypoint)
+		}
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods found for waypoint %v/%v of %v", namespace, name, pod.Name)
+	}
+	return pods, nil
+}
+
+// ztunnel takes a tracing filter rather than Envoy loggers. Its scopes are
+// the targets of its log lines, such as access, xds, proxy or dns, and its
+// levels are those of Envoy but for critical.
+var ztunnelLevels = map[Level]string{
+	TraceLevel:    "trace",
+	DebugLevel:    "debug",
+	InfoLevel:     "info",
+	WarningLevel:  "warn",
+	ErrorLevel:    "error",
+	CriticalLevel: "error",
+	OffLevel:      "off",
+}
+
+// setZtunnelLogLevel applies the level spec to the ztunnel. Scopes can't be
+// listed, so unlike Envoy loggers they aren't validated.
+func setZtunnelLogLevel(logLevel, pod, namespace string) (string, error) {
+	spec, err := parseLevelSpec(logLevel, nil)
+	if err != nil {
+		return "", err
+	}
+	levels, err := spec.resolve(func() (logSnapshot, error) { return getZtunnelSnapshot(pod, namespace) })
+	if err != nil {
+		return "", err
+	}
+
+	var directives []string
+	for _, ll := range levels {
+		if ll.Name == defaultLoggerName {
+			directives = append(directives, ztunnelLevels[ll.Level])
+		} else {
+			directives = append(directives, ztunnelDirective(ll.Name, ll.Level))
+		}
+	}
+	return setupEnvoyLog("level="+strings.Join(directives, ","), pod, namespace)
+}
+
+// ztunnelDirective renders a scope:level directive. Scopes with a module path,
+// such as hickory_server::server, use the equivalent scope=level form.
+func ztunnelDirective(scope string, level Level) string {
+	if strings.Contains(scope, ":") {
+		return scope + "=" + ztunnelLevels[level]
+	}
+	return scope + ":" + ztunnelLevels[level]
+}
+
+// getZtunnelSnapshot reads the current filter of the ztunnel. Like Envoy, it
+// lists it on POST without parameters.
+func getZtunnelSnapshot(pod, namespace string) (logSnapshot, error) {
+	resp, err := setupEnvoyLog("", pod, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseZtunnelSnapshot(resp)
+}
+
+// parseZtunnelSnapshot parses ztunnel's logging response, the default level
+// being reported as the level logger:
+//
+//	current log level is hickory_server::server::server_future=off,info
+func parseZtunnelSnapshot(resp string) (logSnapshot, error) {
+	filter, ok := strings.CutPrefix(strings.TrimSpace(resp), "current log level is ")
+	if !ok {
+		return nil, fmt.Errorf("unexpected ztunnel logging response: %q", resp)
+	}
+
+	var snapshot logSnapshot
+	for _, directive := range strings.Split(filter, ",") {
+		name, level := defaultLoggerName, directive
+		if i := strings.LastIndexAny(directive, "=:"); i >= 0 {
+			name, level = directive[:i], directive[i+1:]
+		}
+		ll, ok := stringToLevel[level]
+		if !ok {
+			if ll, ok = recordLevelAliases[level]; !ok {
+				return nil, fmt.Errorf("unrecognized logging level in ztunnel logging response: %q", directive)
+			}
+		}
+		snapshot = append(snapshot, loggerLevel{Name: name, Level: ll})
+	}
+	return snapshot, nil
+}
+
+// restoreZtunnel resets the ztunnel filter and sets it back to the snapshot
+func (s logSnapshot) restoreZtunnel(pod, namespace string) error {
+	var directives []string
+	for _, ll := range s {
+		if ll.Name == defaultLoggerName {
+			directives = append([]string{ztunnelLevels[ll.Level]}, directives...)
+		} else {
+			directives = append(directives, ztunnelDirective(ll.Name, ll.Level))
+		}
+	}
+	_, err := setupEnvoyLog("reset=true&level="+strings.Join(directives, ","), pod, namespace)
+	return err
+}
@@ -0,0 +1,127 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newAmbientTestPod(name, node string) *appv1.Pod {
+	pod := newTestPod(name, map[string]string{"app": "reviews"}, "app")
+	pod.Annotations = map[string]string{ambientRedirectionAnnotation: "enabled"}
+	pod.Spec.NodeName = node
+	return pod
+}
+
+func newAmbientTestOptions(t *testing.T, pods ...*appv1.Pod) options {
+	options := newTestOptions(t, pods...)
+	cs := options.clientset
+	for _, node := range []string{"node-a", "node-b"} {
+		ztunnel := newTestPod("ztunnel-"+node, map[string]string{ztunnelLabel: ztunnelLabelValue}, istioContainer)
+		ztunnel.Namespace = "istio-system"
+		ztunnel.Spec.NodeName = node
+		if _, err := cs.CoreV1().Pods("istio-system").Create(context.TODO(), ztunnel, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	waypoint := newTestPod("waypoint-1", map[string]string{gatewayNameLabel: "waypoint"}, istioContainer)
+	if _, err := cs.CoreV1().Pods(options.namespace).Create(context.TODO(), waypoint, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err := cs.CoreV1().Namespaces().Create(context.TODO(), &appv1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   options.namespace,
+		Labels: map[string]string{useWaypointLabel: "waypoint"},
+	}}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return options
+}
+
+func TestGetPodsAmbient_A001(t *testing.T) {
+	options := newAmbientTestOptions(t,
+		newAmbientTestPod("reviews-1", "node-b"),
+		newAmbientTestPod("reviews-2", "node-b"),
+		newTestPod("reviews-3", map[string]string{"app": "reviews"}, "app", istioContainer),
+	)
+
+	pods, err := options.getPods(Target{Selector: "app=reviews"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Both ambient pods share the ztunnel of their node
+	if len(pods) != 2 || pods[0].Name != "ztunnel-node-b" || pods[1].Name != "reviews-3" {
+		t.Errorf("Unexpected pods %v", pods)
+	}
+	if !isZtunnel(pods[0]) || isZtunnel(pods[1]) {
+		t.Error("Expected only the ztunnel pod to be detected as such")
+	}
+
+	pods, err = options.getPods(Target{Pod: "reviews-1", Waypoint: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 1 || pods[0].Name != "waypoint-1" {
+		t.Errorf("Expected the namespace waypoint, got %v", pods)
+	}
+}
+
+func TestGetPodsAmbient_A002(t *testing.T) {
+	pod := newAmbientTestPod("reviews-1", "node-c")
+	pod.Labels[useWaypointLabel] = "none"
+	options := newAmbientTestOptions(t, pod)
+
+	if _, err := options.getPods(Target{Pod: "reviews-1"}); err == nil {
+		t.Error("Expected an error without a ztunnel on the node")
+	}
+	if _, err := options.getPods(Target{Pod: "reviews-1", Waypoint: true}); err == nil {
+		t.Error("Expected an error for a pod opted out of the waypoint")
+	}
+}
+
+func TestParseZtunnelSnapshot_A001(t *testing.T) {
+	snapshot, err := parseZtunnelSnapshot("current log level is hickory_server::server::server_future=off,access=warn,info\n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := logSnapshot{
+		{Name: "hickory_server::server::server_future", Level: OffLevel},
+		{Name: "access", Level: WarningLevel},
+		{Name: defaultLoggerName, Level: InfoLevel},
+	}
+	if len(snapshot) != len(expected) {
+		t.Fatalf("Unexpected snapshot %v", snapshot)
+	}
+	for i := range expected {
+		if snapshot[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], snapshot[i])
+		}
+	}
+
+	if _, err := parseZtunnelSnapshot("active loggers:\n  admin: info\n"); err == nil {
+		t.Error("Expected an error for an Envoy response")
+	}
+}
+
+func TestZtunnelDirective_A001(t *testing.T) {
+	if d := ztunnelDirective("access", WarningLevel); d != "access:warn" {
+		t.Errorf("Unexpected directive %q", d)
+	}
+	if d := ztunnelDirective("hickory_server::server", CriticalLevel); d != "hickory_server::server=error" {
+		t.Errorf("Unexpected directive %q", d)
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// captureEndpoints are the Envoy admin endpoints snapshotted before and after
+// the capture window, keyed by the name of their file in the bundle
+var captureEndpoints = []struct {
+	file string
+	path string
+}{
+	{"config_dump.json", "config_dump"},
+	{"clusters.txt", "clusters"},
+	{"stats.txt", "stats"},
+	{"listeners.txt", "listeners"},
+	{"server_info.json", "server_info"},
+}
+
+// captureManifest describes the content of a capture bundle
+type captureManifest struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	LogLevel string        `json:"log_level"`
+	Pods     []capturedPod `json:"pods"`
+}
+
+type capturedPod struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Files     []string `json:"files"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// captureBundle writes the files of a capture into a tar.gz, recording them
+// in the manifest, which is written last.
+type captureBundle struct {
+	mu       sync.Mutex
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	manifest captureManifest
+	pods     map[string]*capturedPod
+}
+
+func newCaptureBundle(out io.Writer, logLevel string, pods []corev1.Pod) *captureBundle {
+	gz := gzip.NewWriter(out)
+	b := &captureBundle{
+		gz:       gz,
+		tw:       tar.NewWriter(gz),
+		manifest: captureManifest{Start: time.Now().UTC(), LogLevel: logLevel},
+		pods:     map[string]*capturedPod{},
+	}
+	b.manifest.Pods = make([]capturedPod, len(pods))
+	for i, pod := range pods {
+		b.manifest.Pods[i] = capturedPod{Name: pod.Name, Namespace: pod.Namespace}
+		b.pods[pod.Namespace+"/"+pod.Name] = &b.manifest.Pods[i]
+	}
+	return b
+}
+
+// add writes a file of the pod, or records the error that prevented it
+func (b *captureBundle) add(pod corev1.Pod, name string, data []byte, err error) error {
+	return b.addFrom(pod, name, bytes.NewReader(data), int64(len(data)), err)
+}
+
+func (b *captureBundle) addFrom(pod corev1.Pod, name string, r io.Reader, size int64, err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.pods[pod.Namespace+"/"+pod.Name]
+	if err != nil {
+		entry.Errors = append(entry.Errors, fmt.Sprintf("%v: %v", name, err))
+		return nil
+	}
+	name = path.Join(pod.Namespace, pod.Name, name)
+	if err := b.write(name, r, size); err != nil {
+		return err
+	}
+	entry.Files = append(entry.Files, name)
+	return nil
+}
+
+func (b *captureBundle) write(name string, r io.Reader, size int64) error {
+	err := b.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err == nil {
+		_, err = io.Copy(b.tw, r)
+	}
+	return err
+}
+
+// close writes the manifest and flushes the archive
+func (b *captureBundle) close() error {
+	b.manifest.End = time.Now().UTC()
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.write("manifest.json", bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return err
+	}
+	return errors.Join(b.tw.Close(), b.gz.Close())
+}
+
+// KubectlIstioLogCapture raises the levels of the targeted proxies for the
+// duration, or until interrupted, and writes a bundle with their logs over
+// that window, snapshots of their admin endpoints before and after it, their
+// pod spec and their events. The levels are restored afterwards.
+func (options *options) KubectlIstioLogCapture(target Target, logLevel string, duration time.Duration, output string) error {
+	if duration <= 0 {
+		return fmt.Errorf("the capture duration must be positive")
+	}
+	pods, err := options.getPods(target)
+	if err != nil {
+		return err
+	}
+	if _, err := parseLevelSpec(logLevel, nil); err != nil {
+		return err
+	}
+
+	snapshots := map[string]logSnapshot{}
+	list := make([]logSnapshot, len(pods))
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		list[i], errs[i] = originalSnapshot(pod)
+	})
+	for i, pod := range pods {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		snapshots[pod.Namespace+"/"+pod.Name] = list[i]
+	}
+
+	// The bundle is written next to output and only renamed to it once
+	// complete, so that a failed capture doesn't leave a truncated one
+	file, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	bundle := newCaptureBundle(file, logLevel, pods)
+
+	// Logs are spooled to temporary files, removed however the capture ends
+	spools := make([]*os.File, len(pods))
+	for i := range pods {
+		spool, err := os.CreateTemp("", "istiolog-capture-*.log")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		spools[i] = spool
+	}
+
+	if err := captureAdmin(bundle, pods, "before"); err != nil {
+		return err
+	}
+
+	if err := handleLogs(logLevel, pods); err != nil {
+		return errors.Join(err, options.restorePods(pods, snapshots, false))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Capturing %d pods until %v, interrupt to stop earlier\n", len(pods), time.Now().Add(duration).Format(time.RFC3339))
+
+	logs := options.captureLogs(ctx, pods, spools, logLevel)
+	// The bundle is still written when levels are left raised
+	restoreErr := options.restorePods(pods, snapshots, false)
+
+	for i, pod := range pods {
+		if err := logs[i].addTo(bundle, pod); err != nil {
+			return errors.Join(err, restoreErr)
+		}
+	}
+	if err := captureAdmin(bundle, pods, "after"); err != nil {
+		return errors.Join(err, restoreErr)
+	}
+	for _, pod := range pods {
+		spec, err := options.podSpec(pod)
+		if err := bundle.add(pod, "pod.yaml", spec, err); err != nil {
+			return errors.Join(err, restoreErr)
+		}
+		events, err := options.podEvents(pod)
+		if err := bundle.add(pod, "events.yaml", events, err); err != nil {
+			return errors.Join(err, restoreErr)
+		}
+	}
+
+	if err := bundle.close(); err != nil {
+		return errors.Join(err, restoreErr)
+	}
+	if err := file.Close(); err != nil {
+		return errors.Join(err, restoreErr)
+	}
+	if err := os.Rename(file.Name(), output); err != nil {
+		return errors.Join(err, restoreErr)
+	}
+	fmt.Fprintf(os.Stderr, "Capture written to %v\n", output)
+	return restoreErr
+}
+
+// captureAdmin snapshots the admin endpoints of every pod under dir. The
+// pods are read concurrently and added to the bundle in order.
+func captureAdmin(bundle *captureBundle, pods []corev1.Pod, dir string) error {
+	data := make([][][]byte, len(pods))
+	errs := make([][]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		data[i] = make([][]byte, len(captureEndpoints))
+		errs[i] = make([]error, len(captureEndpoints))
+		for j, endpoint := range captureEndpoints {
+			data[i][j], errs[i][j] = envoyAdmin("GET", endpoint.path, pod.Name, pod.Namespace)
+		}
+	})
+
+	for i, pod := range pods {
+		for j, endpoint := range captureEndpoints {
+			if err := bundle.add(pod, path.Join(dir, endpoint.file), data[i][j], errs[i][j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// capturedLog is the log of a pod spooled to a temporary file, as debug
+// logs quickly grow large
+type capturedLog struct {
+	spool *os.File
+	err   error
+}
+
+// addTo copies the log into the bundle
+func (l capturedLog) addTo(bundle *captureBundle, pod corev1.Pod) error {
+	name := istioContainer + ".log"
+	if l.err != nil {
+		return bundle.addFrom(pod, name, nil, 0, l.err)
+	}
+
+	size, err := l.spool.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = l.spool.Seek(0, io.SeekStart)
+	}
+	return bundle.addFrom(pod, name, l.spool, size, err)
+}
+
+// captureLogs follows the proxy logs of every pod into its spool file until
+// ctx is done
+func (opts *options) captureLogs(ctx context.Context, pods []corev1.Pod, spools []*os.File, logLevel string) []capturedLog {
+	logs := make([]capturedLog, len(pods))
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod corev1.Pod) {
+			defer wg.Done()
+			logs[i] = opts.capturePodLog(ctx, pod, spools[i], logLevel)
+		}(i, pod)
+	}
+	wg.Wait()
+	return logs
+}
+
+func (opts *options) capturePodLog(ctx context.Context, pod corev1.Pod, spool *os.File, logLevel string) capturedLog {
+	f := newFollower(opts, []corev1.Pod{pod}, istioContainer, spool)
+	f.ctx = ctx
+	f.logLevel = logLevel
+	f.reconnect = true
+	if err := f.run(); err != nil {
+		return capturedLog{err: err}
+	}
+	return capturedLog{spool: spool}
+}
+
+// podSpec returns the current pod as yaml, without its managed fields
+func (opts *options) podSpec(pod corev1.Pod) ([]byte, error) {
+	current, err := opts.clientset.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	current.ManagedFields = nil
+	return yaml.Marshal(current)
+}
+
+// podEvents returns the events of the pod as yaml
+func (opts *options) podEvents(pod corev1.Pod) ([]byte, error) {
+	result, err := opts.clientset.CoreV1().Events(pod.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "involvedObject.name=" + pod.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []corev1.Event
+	for _, event := range result.Items {
+		if event.InvolvedObject.Name == pod.Name && event.InvolvedObject.Kind == "Pod" {
+			event.ManagedFields = nil
+			events = append(events, event)
+		}
+	}
+	return yaml.Marshal(events)
+}
@@ -0,0 +1,169 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// readTestBundle returns the files of a bundle by name
+func readTestBundle(t *testing.T, data []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		files[header.Name] = string(content)
+	}
+}
+
+func TestCaptureBundle_A001(t *testing.T) {
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	pod.Status.Phase = appv1.PodSucceeded
+	options := newTestOptions(t, pod)
+
+	var out bytes.Buffer
+	bundle := newCaptureBundle(&out, "debug", []appv1.Pod{*pod})
+	if err := bundle.add(*pod, "before/clusters.txt", []byte("outbound|9080||reviews"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := bundle.add(*pod, "before/stats.txt", nil, errors.New("connection refused")); err != nil {
+		t.Fatal(err.Error())
+	}
+	spool, err := os.CreateTemp(t.TempDir(), "spool")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer spool.Close()
+	logs := options.captureLogs(context.Background(), []appv1.Pod{*pod}, []*os.File{spool}, "debug")
+	if err := logs[0].addTo(bundle, *pod); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := bundle.close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	files := readTestBundle(t, out.Bytes())
+	if files["unit-test-namespace/reviews-1/before/clusters.txt"] != "outbound|9080||reviews" {
+		t.Errorf("Unexpected files %v", files)
+	}
+	if files["unit-test-namespace/reviews-1/istio-proxy.log"] != "fake logs\n" {
+		t.Errorf("Unexpected log %q", files["unit-test-namespace/reviews-1/istio-proxy.log"])
+	}
+
+	var manifest captureManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatal(err.Error())
+	}
+	if manifest.LogLevel != "debug" || len(manifest.Pods) != 1 {
+		t.Fatalf("Unexpected manifest %+v", manifest)
+	}
+	captured := manifest.Pods[0]
+	if len(captured.Files) != 2 || len(captured.Errors) != 1 || !strings.Contains(captured.Errors[0], "before/stats.txt: connection refused") {
+		t.Errorf("Unexpected manifest entry %+v", captured)
+	}
+}
+
+func TestPodEvents_A001(t *testing.T) {
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	options := newTestOptions(t, pod)
+	for _, event := range []appv1.Event{
+		{ObjectMeta: metav1.ObjectMeta{Name: "e1"}, InvolvedObject: appv1.ObjectReference{Kind: "Pod", Name: "reviews-1"}, Reason: "Unhealthy"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "e2"}, InvolvedObject: appv1.ObjectReference{Kind: "Pod", Name: "ratings-1"}, Reason: "Killing"},
+	} {
+		if _, err := options.clientset.CoreV1().Events(options.namespace).Create(context.TODO(), &event, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	events, err := options.podEvents(*pod)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(string(events), "reason: Unhealthy") || strings.Contains(string(events), "Killing") {
+		t.Errorf("Unexpected events %v", string(events))
+	}
+
+	spec, err := options.podSpec(*pod)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(string(spec), "name: reviews-1") {
+		t.Errorf("Unexpected pod spec %v", string(spec))
+	}
+}
+
+func TestKubectlIstioLogCapture_A001(t *testing.T) {
+	unreachableProxies(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// Levels recorded for a revert are read without reaching the proxy
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	options := newTestOptions(t, pod)
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := options.recordRevert(*pod, snapshot, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "capture.tar.gz")
+	if err := options.KubectlIstioLogCapture(Target{Pod: "reviews-1"}, "debug", time.Minute, output); err == nil {
+		t.Fatal("Expected the capture to fail on unreachable proxies")
+	}
+	spools, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(spools) != 0 {
+		t.Errorf("Expected the spool files to be removed, found %v", spools)
+	}
+	// Nor is a truncated bundle left behind
+	bundles, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(bundles) != 0 {
+		t.Errorf("Expected no bundle to be written, found %v", bundles)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// correlationWindow is how long lines are held back before being printed.
+// Lines of a stream logged before the line revealing its request id are
+// still printed as long as they are within the window, and lines of the
+// different pods are printed in time order.
+const correlationWindow = 2 * time.Second
+
+// correlator only lets through the lines of the pods that belong to a
+// request. A line belongs to it when it contains the request or trace id, as
+// access log entries and request header dumps do. The Envoy stream of such a
+// line is then linked to the request so its other lines are let through too.
+type correlator struct {
+	mu      sync.Mutex
+	ids     []string
+	window  time.Duration
+	linked  map[string]bool
+	last    map[string]string
+	pending []correlatedLine
+	// err is the first error writing lines, after which no more lines are
+	// held back
+	err error
+}
+
+type correlatedLine struct {
+	ts      time.Time
+	arrival time.Time
+	key     string
+	matched bool
+	write   func() error
+}
+
+func newCorrelator(window time.Duration, ids ...string) *correlator {
+	c := &correlator{
+		window: window,
+		linked: map[string]bool{},
+		last:   map[string]string{},
+	}
+	for _, id := range ids {
+		if id != "" {
+			c.ids = append(c.ids, id)
+		}
+	}
+	return c
+}
+
+// observe links the stream of the line to the request when the line
+// contains one of the ids. It returns the key of the line's stream, if any,
+// and whether the line itself matched.
+func (c *correlator) observe(pod, line string, record logRecord) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var key string
+	if record.Time == "" && record.AccessLog == nil {
+		// Multi-line messages, such as header dumps, continue the previous
+		// line of the pod
+		key = c.last[pod]
+	} else {
+		if record.Stream != "" {
+			key = pod + "/S" + record.Stream
+		}
+		c.last[pod] = key
+	}
+
+	matched := false
+	for _, id := range c.ids {
+		if strings.Contains(line, id) {
+			matched = true
+			break
+		}
+	}
+	if matched && key != "" {
+		c.linked[key] = true
+	}
+	return key, matched
+}
+
+// add holds the line back until it is flushed. Once writing lines failed,
+// the line is dropped and the error returned instead.
+func (c *correlator) add(ts time.Time, key string, matched bool, write func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	arrival := time.Now()
+	if ts.IsZero() {
+		ts = arrival
+	}
+	c.pending = append(c.pending, correlatedLine{
+		ts:      ts,
+		arrival: arrival,
+		key:     key,
+		matched: matched,
+		write:   write,
+	})
+	return nil
+}
+
+// flush writes, in time order, the lines that arrived before the given time
+// and belong to the request, dropping the others. On the first error, the
+// lines still pending are dropped as they would never be written.
+func (c *correlator) flush(before time.Time) error {
+	c.mu.Lock()
+	var ready, pending []correlatedLine
+	for _, line := range c.pending {
+		if line.arrival.Before(before) {
+			if line.matched || (line.key != "" && c.linked[line.key]) {
+				ready = append(ready, line)
+			}
+		} else {
+			pending = append(pending, line)
+		}
+	}
+	c.pending = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].ts.Before(ready[j].ts)
+	})
+	for _, line := range ready {
+		if err := line.write(); err != nil {
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.pending = nil
+			c.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// drain flushes every line held back
+func (c *correlator) drain() error {
+	return c.flush(time.Now().Add(time.Hour))
+}
+
+// run flushes the lines older than the window until stop is closed, then
+// flushes every remaining line.
+func (c *correlator) run(stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.window / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.flush(time.Now().Add(-c.window)); err != nil {
+				return err
+			}
+		case <-stop:
+			return c.drain()
+		}
+	}
+}
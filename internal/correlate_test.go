@@ -0,0 +1,163 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCorrelator_A001(t *testing.T) {
+	base := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	lines := []struct {
+		pod  string
+		at   time.Duration
+		line string
+	}{
+		{"productpage", 100, "2023-08-01T10:00:00.100000Z\tdebug\tenvoy http external/envoy/source/common/http/conn_manager_impl.cc:329\t[C1][S2] request headers complete (end_stream=true):\tthread=21"},
+		{"productpage", 101, "'x-request-id', '7e5c-42'"},
+		{"productpage", 102, "2023-08-01T10:00:00.102000Z\tdebug\tenvoy router external/envoy/source/common/router/router.cc:470\t[C1][S2] cluster 'outbound|9080||reviews' match for URL '/reviews/0'\tthread=21"},
+		{"productpage", 103, "2023-08-01T10:00:00.103000Z\tdebug\tenvoy router external/envoy/source/common/router/router.cc:470\t[C3][S4] cluster 'outbound|9080||ratings' match for URL '/ratings/0'\tthread=21"},
+		{"reviews", 150, `[2023-08-01T10:00:00.150Z] "GET /reviews/0 HTTP/1.1" 200 - via_upstream - "-" 0 358 5 4 "-" "curl" "7e5c-42" "reviews:9080" "10.0.0.1:9080" inbound|9080|| 127.0.0.6:1 10.0.0.1:9080 10.0.0.2:1 - default`},
+		{"productpage", 120, "2023-08-01T10:00:00.120000Z\tdebug\tenvoy http external/envoy/source/common/http/conn_manager_impl.cc:1600\t[C1][S2] encoding headers via codec (end_stream=false)\tthread=21"},
+	}
+
+	c := newCorrelator(time.Second, "7e5c-42")
+	var out []string
+	for _, l := range lines {
+		l := l
+		key, matched := c.observe(l.pod, l.line, parseLogRecord(l.line))
+		c.add(base.Add(l.at*time.Millisecond), key, matched, func() error {
+			out = append(out, l.pod+" "+l.line)
+			return nil
+		})
+	}
+	if err := c.flush(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The stream of the header dump is linked to the request, lines of other
+	// streams are dropped and every line is in time order
+	expected := []int{0, 1, 2, 5, 4}
+	if len(out) != len(expected) {
+		t.Fatalf("Expected %d lines, got %q", len(expected), out)
+	}
+	for i, index := range expected {
+		if out[i] != lines[index].pod+" "+lines[index].line {
+			t.Errorf("Unexpected line %d %q", i, out[i])
+		}
+	}
+	if !strings.HasPrefix(out[4], "reviews ") {
+		t.Errorf("Expected the access log last, got %q", out[4])
+	}
+}
+
+func TestCorrelator_A002(t *testing.T) {
+	c := newCorrelator(time.Hour, "", "4bf92f3577b34da6")
+	line := "2023-08-01T10:00:00.100000Z\tdebug\tenvoy http external/envoy/source/common/http/conn_manager_impl.cc:329\t[C1][S2] request end stream\tthread=21"
+	key, matched := c.observe("reviews", line, parseLogRecord(line))
+	if key != "reviews/S2" || matched {
+		t.Errorf("Unexpected key %q matched=%v", key, matched)
+	}
+
+	written := false
+	c.add(time.Time{}, key, matched, func() error {
+		written = true
+		return nil
+	})
+	// Lines are held back for the window
+	if err := c.flush(time.Now().Add(-time.Hour)); err != nil || written || len(c.pending) != 1 {
+		t.Errorf("Expected the line to be pending, written=%v err=%v", written, err)
+	}
+	if err := c.flush(time.Now().Add(time.Second)); err != nil || written || len(c.pending) != 0 {
+		t.Errorf("Expected the unrelated line to be dropped, written=%v err=%v", written, err)
+	}
+}
+
+func TestCorrelator_A003(t *testing.T) {
+	c := newCorrelator(time.Hour, "7e5c-42")
+	failed := errors.New("broken pipe")
+	for i := 0; i < 3; i++ {
+		if err := c.add(time.Time{}, "", true, func() error { return failed }); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := c.flush(time.Now().Add(time.Hour)); err != failed {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+
+	// Once writing failed, lines are no longer held back
+	if err := c.add(time.Time{}, "", true, func() error { return nil }); err != failed {
+		t.Errorf("Expected the write error, got %v", err)
+	}
+	if len(c.pending) != 0 {
+		t.Errorf("Expected no pending lines, got %d", len(c.pending))
+	}
+}
+
+func TestFollowerDrain_A001(t *testing.T) {
+	options := newTestOptions(t)
+	var out bytes.Buffer
+	f := newFollower(&options, nil, istioContainer, &out)
+	if err := f.drain(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	f.requests = newCorrelator(time.Hour, "7e5c-42")
+	pod := *newTestPod("reviews-1", nil, istioContainer)
+	line := `[2023-08-01T10:00:00.150Z] "GET /reviews/0 HTTP/1.1" 200 - via_upstream - "-" 0 358 5 4 "-" "curl" "7e5c-42" "reviews:9080" "10.0.0.1:9080" inbound|9080|| 127.0.0.6:1 10.0.0.1:9080 10.0.0.2:1 - default`
+	if err := f.printLine(pod, "", time.Time{}, line); err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Expected the line to be held back, got %q", out.String())
+	}
+
+	// Lines held back within the window are printed by drain
+	if err := f.drain(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.String() != line+"\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+func TestFollowerDrain_A002(t *testing.T) {
+	options := newTestOptions(t)
+	f := newFollower(&options, nil, istioContainer, &bytes.Buffer{})
+	f.stream.Summary = time.Hour
+	f.summary = newAccessLogSummary()
+	pod := *newTestPod("reviews-1", nil, istioContainer)
+	if err := f.printLine(pod, "", time.Time{}, testTextAccessLog); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The last summary is printed by drain, and not again once following
+	// stops
+	output := redirectOutput(t)
+	if err := f.drain(); err != nil {
+		t.Fatal(err.Error())
+	}
+	stop := make(chan struct{})
+	close(stop)
+	f.printSummaries(os.Stderr, stop)
+
+	_, errOut := output()
+	if strings.Count(errOut, "--- 1 of 1 requests failed in the last 1h0m0s") != 1 {
+		t.Errorf("Expected the summary once, got %q", errOut)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// levelChange is the change of level of a single logger
+type levelChange struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// KubectlIstioLogDryRun prints, for every targeted proxy, the loggers whose
+// level the level spec would change. Levels are only read, with the same
+// parameterless logging request as `get`, so nothing changes on the proxies.
+func (options *options) KubectlIstioLogDryRun(target Target, logLevel string) error {
+	pods, err := options.getPods(target)
+	if err != nil {
+		return err
+	}
+	if _, err := parseLevelSpec(logLevel, nil); err != nil {
+		return err
+	}
+
+	snapshots := make([]logSnapshot, len(pods))
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		snapshots[i], errs[i] = podSnapshot(pod)
+	})
+
+	failed := 0
+	for i, pod := range pods {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", pod.Name, errs[i])
+			failed++
+			continue
+		}
+		snapshot := snapshots[i]
+		// Every logger of Envoy and istiod is listed, ztunnel scopes aren't
+		var loggers []string
+		if !isZtunnel(pod) {
+			for _, ll := range snapshot {
+				loggers = append(loggers, ll.Name)
+			}
+		}
+		spec, err := parseLevelSpec(logLevel, loggers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", pod.Name, err)
+			failed++
+			continue
+		}
+		levels, err := spec.resolve(func() (logSnapshot, error) { return snapshot, nil })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", pod.Name, err)
+			failed++
+			continue
+		}
+		printLevelChanges(os.Stdout, pod.Name, pod.Namespace, levelChanges(snapshot, levels))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to check log levels of %d of %d pods", failed, len(pods))
+	}
+	return nil
+}
+
+// levelChanges returns the loggers of the snapshot whose level differs once
+// the levels are applied, followed by the requested loggers it doesn't list.
+// The level of every logger applies first. Then, as Envoy's fine-grain
+// logger matches a file against the paths in the order given and stops at
+// the first match, the first logger matching by name or path glob wins.
+func levelChanges(snapshot logSnapshot, levels logSnapshot) []levelChange {
+	var changes []levelChange
+	listed := map[string]bool{}
+	for _, ll := range snapshot {
+		listed[ll.Name] = true
+		after, ok := ll.Level, false
+		for _, level := range levels {
+			if level.Name == defaultLoggerName {
+				after, ok = level.Level, true
+			}
+		}
+		for _, level := range levels {
+			if level.Name != defaultLoggerName && (level.Name == ll.Name || (isPathGlob(level.Name) && globMatch(level.Name, ll.Name))) {
+				after, ok = level.Level, true
+				break
+			}
+		}
+		if ok && after != ll.Level {
+			changes = append(changes, levelChange{Name: ll.Name, Before: ll.Level.String(), After: after.String()})
+		}
+	}
+	for _, ll := range levels {
+		if !listed[ll.Name] && ll.Name != defaultLoggerName && !isPathGlob(ll.Name) {
+			listed[ll.Name] = true
+			changes = append(changes, levelChange{Name: ll.Name, Before: "<none>", After: ll.Level.String()})
+		}
+	}
+	return changes
+}
+
+func printLevelChanges(out io.Writer, pod, namespace string, changes []levelChange) {
+	fmt.Fprintf(out, "%v (%v):\n", pod, namespace)
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "  no changes")
+	}
+	for _, change := range changes {
+		fmt.Fprintf(out, "  %v: %v -> %v\n", change.Name, change.Before, change.After)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLevelChanges_A001(t *testing.T) {
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	levels := specSnapshot(t, "info,http:debug,router:trace", nil)
+
+	var out bytes.Buffer
+	printLevelChanges(&out, "reviews-1", "bookinfo", levelChanges(snapshot, levels))
+	expected := `reviews-1 (bookinfo):
+  admin: warning -> info
+  router: info -> trace
+  upstream: warning -> info
+`
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestLevelChanges_A002(t *testing.T) {
+	snapshot, err := parseZtunnelSnapshot("current log level is info")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	levels := specSnapshot(t, "info,access:debug", nil)
+
+	changes := levelChanges(snapshot, levels)
+	if len(changes) != 1 || changes[0] != (levelChange{Name: "access", Before: "<none>", After: "debug"}) {
+		t.Errorf("Unexpected changes %v", changes)
+	}
+
+	var out bytes.Buffer
+	printLevelChanges(&out, "reviews-1", "bookinfo", levelChanges(snapshot, logSnapshot{{Name: defaultLoggerName, Level: InfoLevel}}))
+	if out.String() != "reviews-1 (bookinfo):\n  no changes\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+func TestLevelChanges_A003(t *testing.T) {
+	snapshot, err := parseLogSnapshot(`active loggers:
+  source/common/http/conn_manager_impl.cc: info
+  source/common/http/http1/codec_impl.cc: info
+  source/common/router/router.cc: info
+`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	levels := specSnapshot(t, "source/common/http/*:debug", nil)
+
+	var out bytes.Buffer
+	printLevelChanges(&out, "reviews-1", "bookinfo", levelChanges(snapshot, levels))
+	expected := `reviews-1 (bookinfo):
+  source/common/http/conn_manager_impl.cc: info -> debug
+  source/common/http/http1/codec_impl.cc: info -> debug
+`
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// Like Envoy, the first matching glob wins
+	snapshot, err = parseLogSnapshot(`active loggers:
+  source/common/http/conn_manager_impl.cc: warning
+  source/common/router/router.cc: warning
+`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tests := []struct {
+		logLevel string
+		expected []levelChange
+	}{
+		{"source/common/*:info,source/common/http/*:debug", []levelChange{
+			{Name: "source/common/http/conn_manager_impl.cc", Before: "warning", After: "info"},
+			{Name: "source/common/router/router.cc", Before: "warning", After: "info"},
+		}},
+		{"source/common/http/*:debug,source/common/*:info", []levelChange{
+			{Name: "source/common/http/conn_manager_impl.cc", Before: "warning", After: "debug"},
+			{Name: "source/common/router/router.cc", Before: "warning", After: "info"},
+		}},
+		// The level of every logger applies first, wherever it is given
+		{"source/common/http/*:debug,error", []levelChange{
+			{Name: "source/common/http/conn_manager_impl.cc", Before: "warning", After: "debug"},
+			{Name: "source/common/router/router.cc", Before: "warning", After: "error"},
+		}},
+	}
+	for _, test := range tests {
+		changes := levelChanges(snapshot, specSnapshot(t, test.logLevel, nil))
+		if !reflect.DeepEqual(changes, test.expected) {
+			t.Errorf("Unexpected changes %v for %v", changes, test.logLevel)
+		}
+	}
+}
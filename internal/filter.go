@@ -0,0 +1,116 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Levels used by pilot-agent that Envoy spells differently
+var recordLevelAliases = map[string]Level{
+	"warn":  WarningLevel,
+	"fatal": CriticalLevel,
+}
+
+// lineFilter selects the followed lines to print
+type lineFilter struct {
+	grep      *regexp.Regexp
+	exclude   *regexp.Regexp
+	minLevel  *Level
+	loggers   map[string]bool
+	accessLog []accessLogCondition
+}
+
+func newLineFilter(stream StreamOptions) (*lineFilter, error) {
+	filter := &lineFilter{}
+
+	var err error
+	if stream.Grep != "" {
+		if filter.grep, err = regexp.Compile(stream.Grep); err != nil {
+			return nil, fmt.Errorf("invalid --grep expression: %v", err)
+		}
+	}
+	if stream.Exclude != "" {
+		if filter.exclude, err = regexp.Compile(stream.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid --exclude expression: %v", err)
+		}
+	}
+	if stream.MinLevel != "" {
+		level, ok := stringToLevel[stream.MinLevel]
+		if !ok || level == OffLevel {
+			return nil, fmt.Errorf("unrecognized logging level: %v", stream.MinLevel)
+		}
+		filter.minLevel = &level
+	}
+	if stream.AccessLog != "" {
+		if filter.accessLog, err = parseAccessLogFilter(stream.AccessLog); err != nil {
+			return nil, err
+		}
+	}
+	if len(stream.Loggers) > 0 {
+		filter.loggers = map[string]bool{}
+		for _, logger := range stream.Loggers {
+			filter.loggers[logger] = true
+		}
+	}
+	return filter, nil
+}
+
+// needsRecord reports whether the filter looks at the parsed fields of lines
+func (f *lineFilter) needsRecord() bool {
+	return f.minLevel != nil || f.loggers != nil || f.accessLog != nil
+}
+
+// match reports whether the line is printed. The expressions apply to the
+// whole line, the level and logger filters to its parsed fields, so lines
+// without a level or a logger never pass them. Likewise only access log
+// entries pass access log conditions.
+func (f *lineFilter) match(line string, record logRecord) bool {
+	if f.grep != nil && !f.grep.MatchString(line) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(line) {
+		return false
+	}
+	if f.minLevel != nil {
+		level, ok := recordLevel(record)
+		if !ok || level > *f.minLevel {
+			return false
+		}
+	}
+	if f.loggers != nil && !f.loggers[record.Logger] {
+		return false
+	}
+	if f.accessLog != nil {
+		if record.AccessLog == nil {
+			return false
+		}
+		for _, condition := range f.accessLog {
+			if !condition(record.AccessLog) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func recordLevel(record logRecord) (Level, bool) {
+	if level, ok := stringToLevel[record.Level]; ok {
+		return level, true
+	}
+	level, ok := recordLevelAliases[record.Level]
+	return level, ok
+}
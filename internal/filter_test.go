@@ -0,0 +1,75 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+)
+
+var testFilterLines = []string{
+	"2023-08-01T10:00:00.100000Z\tdebug\tenvoy router external/envoy/source/common/router/router.cc:470\t[C1][S2] cluster 'outbound|9080||reviews' match for URL '/reviews/0', authority reviews:9080\tthread=21",
+	"2023-08-01T10:00:00.200000Z\tdebug\tenvoy router external/envoy/source/common/router/router.cc:470\t[C3][S4] cluster 'outbound|9080||ratings' match for URL '/ratings/0', authority ratings:9080\tthread=21",
+	"2023-08-01T10:00:00.300000Z\tdebug\tenvoy http external/envoy/source/common/http/conn_manager_impl.cc:329\t[C1][S2] request end stream\tthread=21",
+	"2023-08-01T10:00:00.400000Z\twarning\tenvoy rbac external/envoy/source/extensions/filters/http/rbac/rbac_filter.cc:167\t[C5][S6] enforced denied\tthread=22",
+	"2023-08-01T10:00:00.500000Z\twarn\txdsproxy\tupstream terminated",
+	`[2023-08-01T10:00:00.600Z] "GET /reviews/0 HTTP/1.1" 503 UH no_healthy_upstream`,
+}
+
+func matchingLines(t *testing.T, stream StreamOptions) []int {
+	filter, err := newLineFilter(stream)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var matched []int
+	for i, line := range testFilterLines {
+		if filter.match(line, parseLogRecord(line)) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+func TestLineFilter_A001(t *testing.T) {
+	tests := []struct {
+		stream   StreamOptions
+		expected []int
+	}{
+		{StreamOptions{}, []int{0, 1, 2, 3, 4, 5}},
+		{StreamOptions{Loggers: []string{"router"}, Grep: "authority reviews"}, []int{0}},
+		{StreamOptions{Exclude: `\[C1\]`}, []int{1, 3, 4, 5}},
+		{StreamOptions{MinLevel: "warning"}, []int{3, 4}},
+		{StreamOptions{Loggers: []string{"router", "rbac"}}, []int{0, 1, 3}},
+	}
+	for _, test := range tests {
+		matched := matchingLines(t, test.stream)
+		if len(matched) != len(test.expected) {
+			t.Errorf("Filter %+v matched lines %v, expected %v", test.stream, matched, test.expected)
+			continue
+		}
+		for i := range matched {
+			if matched[i] != test.expected[i] {
+				t.Errorf("Filter %+v matched lines %v, expected %v", test.stream, matched, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestLineFilter_A002(t *testing.T) {
+	if _, err := newLineFilter(StreamOptions{Grep: "("}); err == nil {
+		t.Errorf("Error while using illegal --grep expression")
+	}
+	if _, err := newLineFilter(StreamOptions{MinLevel: "verbose"}); err == nil {
+		t.Errorf("Error while using illegal --min-level")
+	}
+}
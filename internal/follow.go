@@ -0,0 +1,448 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// maxReconnectAttempts bounds the consecutive failed attempts to open a
+	// log stream before giving up on a pod
+	maxReconnectAttempts = 10
+	maxReconnectBackoff  = 30 * time.Second
+)
+
+// StreamOptions controls which of the followed logs are printed and how
+type StreamOptions struct {
+	// Output is the format of the printed lines: raw, json or logfmt
+	Output string
+	// Grep and Exclude are regular expressions lines must and must not match
+	Grep    string
+	Exclude string
+	// MinLevel drops lines less severe than the level
+	MinLevel string
+	// Loggers only keeps the lines of the given Envoy loggers
+	Loggers []string
+	// AccessLog only keeps the access log entries meeting the conditions
+	AccessLog string
+	// Summary prints the top failing routes and response flags of the access
+	// log at this interval
+	Summary time.Duration
+	// RequestID and TraceID only keep the lines belonging to the request
+	RequestID string
+	TraceID   string
+	// StatsDiff prints the Envoy counters that increased over the session
+	StatsDiff bool
+}
+
+func (s StreamOptions) validate() error {
+	switch s.Output {
+	case "", "raw", "json", "logfmt":
+	default:
+		return fmt.Errorf("unsupported output format: %v", s.Output)
+	}
+	_, err := newLineFilter(s)
+	return err
+}
+
+// follower streams the logs of a container of several pods, merged line by
+// line. With reconnect set, streams are re-opened when they drop or the
+// container restarts, and the log level is re-applied to restarted proxies.
+// Streams stop when ctx is done.
+type follower struct {
+	ctx       context.Context
+	opts      *options
+	pods      []corev1.Pod
+	container string
+	logLevel  string
+	reconnect bool
+	color     bool
+	stream    StreamOptions
+	filter    *lineFilter
+	summary   *accessLogSummary
+	// summarized makes sure the last summary is printed once
+	summarized sync.Once
+	requests   *correlator
+	out        *lineWriter
+}
+
+func newFollower(opts *options, pods []corev1.Pod, containerName string, out io.Writer) *follower {
+	return &follower{
+		ctx:       context.Background(),
+		opts:      opts,
+		pods:      pods,
+		container: containerName,
+		filter:    &lineFilter{},
+		out:       &lineWriter{out: out},
+	}
+}
+
+// followLogs follows the container logs of every pod until all of them
+// terminated, re-applying logLevel to the proxies that restart.
+func (opts *options) followLogs(pods []corev1.Pod, containerName string, logLevel string, stream StreamOptions) error {
+	f, err := opts.newLogFollower(pods, containerName, logLevel, stream)
+	if err != nil {
+		return err
+	}
+	return f.follow()
+}
+
+// newLogFollower returns the follower of the container logs of every pod,
+// printing them to the standard output as requested by stream.
+func (opts *options) newLogFollower(pods []corev1.Pod, containerName string, logLevel string, stream StreamOptions) (*follower, error) {
+	filter, err := newLineFilter(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFollower(opts, pods, containerName, os.Stdout)
+	f.logLevel = logLevel
+	f.stream = stream
+	f.filter = filter
+	f.reconnect = true
+	f.color = useColor(os.Stdout)
+	if stream.RequestID != "" || stream.TraceID != "" {
+		f.requests = newCorrelator(correlationWindow, stream.RequestID, stream.TraceID)
+	}
+	if stream.Summary > 0 {
+		f.summary = newAccessLogSummary()
+	}
+	return f, nil
+}
+
+// follow runs the follower, printing the access log summaries meanwhile
+func (f *follower) follow() error {
+	if f.summary != nil {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			f.printSummaries(os.Stderr, stop)
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+	}
+	return f.run()
+}
+
+// drain prints the lines held back by the correlator and the last access log
+// summary, for when the process exits before the follower returns
+func (f *follower) drain() error {
+	var err error
+	if f.requests != nil {
+		err = f.requests.drain()
+	}
+	if f.summary != nil {
+		f.printLastSummary(os.Stderr)
+	}
+	return err
+}
+
+// run concurrently streams the logs of every pod, returning once all streams
+// ended. Lines are only prefixed when there is more than one pod.
+func (f *follower) run() error {
+	var flushed chan error
+	if f.requests != nil {
+		stop := make(chan struct{})
+		flushed = make(chan error, 1)
+		go func() { flushed <- f.requests.run(stop) }()
+		defer func() {
+			close(stop)
+			<-flushed
+		}()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(f.pods))
+	for i, pod := range f.pods {
+		wg.Add(1)
+		go func(i int, pod corev1.Pod) {
+			defer wg.Done()
+			prefix := ""
+			if len(f.pods) > 1 {
+				prefix = podPrefix(pod.Name, f.container, f.color)
+			}
+			err := f.followPod(pod, func(ts time.Time, line string) error {
+				return f.printLine(pod, prefix, ts, line)
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("%v: %v", pod.Name, err)
+			}
+		}(i, pod)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// printLine prints a log line of the pod in the requested output format if
+// it passes the filters. Raw lines are prefixed to tell pods apart,
+// structured lines carry the pod in their fields instead. When following a
+// request, the line is handed to the correlator, which prints it later on if
+// it belongs to the request.
+func (f *follower) printLine(pod corev1.Pod, prefix string, ts time.Time, line string) error {
+	raw := f.stream.Output == "" || f.stream.Output == "raw"
+
+	var record logRecord
+	if !raw || f.filter.needsRecord() || f.summary != nil || f.requests != nil {
+		record = parseLogRecord(line)
+	}
+	if f.summary != nil && record.AccessLog != nil {
+		f.summary.add(record.AccessLog)
+	}
+
+	var key string
+	var matched bool
+	if f.requests != nil {
+		key, matched = f.requests.observe(pod.Name, line, record)
+	}
+	if !f.filter.match(line, record) {
+		return nil
+	}
+
+	text := line
+	if !raw {
+		record.Pod = pod.Name
+		record.Namespace = pod.Namespace
+		record.Container = f.container
+		var err error
+		if text, err = formatLogRecord(record, f.stream.Output); err != nil {
+			return err
+		}
+		prefix = ""
+	}
+
+	if f.requests != nil {
+		return f.requests.add(ts, key, matched, func() error {
+			return f.out.writeLine(prefix, text)
+		})
+	}
+	return f.out.writeLine(prefix, text)
+}
+
+// printSummaries prints the access log summary at every interval until stop
+// is closed, then once more for the entries seen since the last one.
+// Summaries go to out rather than the followed lines, which may be piped to
+// other tools.
+func (f *follower) printSummaries(out io.Writer, stop <-chan struct{}) {
+	ticker := time.NewTicker(f.stream.Summary)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.out.mu.Lock()
+			f.summary.print(out, f.stream.Summary)
+			f.out.mu.Unlock()
+		case <-stop:
+			f.printLastSummary(out)
+			return
+		}
+	}
+}
+
+// printLastSummary prints the summary for the entries seen since the last
+// one, only the first time it is called
+func (f *follower) printLastSummary(out io.Writer) {
+	f.summarized.Do(func() {
+		f.out.mu.Lock()
+		f.summary.print(out, f.stream.Summary)
+		f.out.mu.Unlock()
+	})
+}
+
+// followPod streams the logs of a pod, reconnecting from the last line seen
+// until the pod terminates.
+func (f *follower) followPod(pod corev1.Pod, handle func(ts time.Time, line string) error) error {
+	restarts := restartCount(pod, f.container)
+	var since time.Time
+	attempts := 0
+	for {
+		err := f.streamPod(pod, &since, func(ts time.Time, line string) error {
+			attempts = 0
+			return handle(ts, line)
+		})
+		if f.ctx.Err() != nil {
+			return nil
+		}
+		if !f.reconnect {
+			return err
+		}
+		if since.IsZero() {
+			since = time.Now()
+		}
+
+		current, done, perr := f.waitForContainer(pod)
+		if perr != nil || done {
+			return perr
+		}
+		if n := restartCount(*current, f.container); n > restarts {
+			restarts = n
+			f.reapplyLogLevel(*current)
+		}
+
+		attempts++
+		if attempts > maxReconnectAttempts {
+			return fmt.Errorf("giving up after %d attempts to stream logs: %v", maxReconnectAttempts, err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: log stream dropped, reconnecting: %v\n", pod.Name, err)
+		}
+		time.Sleep(reconnectBackoff(attempts))
+	}
+}
+
+// streamPod streams the logs of the pod once, from since when set. Lines are
+// requested with timestamps, which are handed to handle separately and kept
+// in since to reconnect from. The API only honours since to the second, so
+// lines up to the since the stream was opened with, already seen, are
+// skipped. Lines of a stream may share their timestamp and are all kept.
+func (f *follower) streamPod(pod corev1.Pod, since *time.Time, handle func(ts time.Time, line string) error) error {
+	podLogOptions := corev1.PodLogOptions{
+		Container:  f.container,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if since.IsZero() {
+		count := int64(1)
+		podLogOptions.TailLines = &count
+	} else {
+		sinceTime := metav1.NewTime(*since)
+		podLogOptions.SinceTime = &sinceTime
+	}
+
+	req := f.opts.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &podLogOptions)
+	stream, err := req.Stream(f.ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	from := *since
+	return readLines(stream, maxLineSize, func(line string) error {
+		ts, text, ok := splitTimestamp(line)
+		if ok {
+			if !from.IsZero() && !ts.After(from) {
+				return nil
+			}
+			*since = ts
+		}
+		return handle(ts, text)
+	})
+}
+
+// splitTimestamp splits the RFC3339 timestamp the API server prepends to
+// lines when asked for timestamps.
+func splitTimestamp(line string) (time.Time, string, bool) {
+	tsText, text, found := strings.Cut(line, " ")
+	if !found {
+		tsText, text = line, ""
+	}
+	ts, err := time.Parse(time.RFC3339Nano, tsText)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, text, true
+}
+
+// waitForContainer waits for the container to run again after its stream
+// ended. done is set when the pod terminated and there is nothing left to
+// follow.
+func (f *follower) waitForContainer(pod corev1.Pod) (*corev1.Pod, bool, error) {
+	for attempts := 1; ; attempts++ {
+		current, err := f.opts.clientset.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "%v: pod deleted, stopped following\n", pod.Name)
+			return nil, true, nil
+		}
+		if err == nil {
+			if current.DeletionTimestamp != nil || current.Status.Phase == corev1.PodSucceeded || current.Status.Phase == corev1.PodFailed {
+				fmt.Fprintf(os.Stderr, "%v: pod terminated, stopped following\n", pod.Name)
+				return nil, true, nil
+			}
+			if !isWaiting(*current, f.container) {
+				return current, false, nil
+			}
+		}
+		if attempts > maxReconnectAttempts {
+			if err == nil {
+				err = fmt.Errorf("%v container is not running", f.container)
+			}
+			return nil, false, err
+		}
+		time.Sleep(reconnectBackoff(attempts))
+	}
+}
+
+// reapplyLogLevel sets the requested log level again on a proxy that
+// restarted, since a new Envoy starts with the default levels.
+func (f *follower) reapplyLogLevel(pod corev1.Pod) {
+	fmt.Fprintf(os.Stderr, "%v: %v restarted, re-applying log level %v\n", pod.Name, f.container, f.logLevel)
+
+	var err error
+	for attempts := 1; attempts <= maxReconnectAttempts; attempts++ {
+		if _, err = setPodLogLevel(f.logLevel, pod); err == nil {
+			return
+		}
+		// Envoy may still be starting up
+		time.Sleep(reconnectBackoff(attempts))
+	}
+	fmt.Fprintf(os.Stderr, "%v: failed to re-apply log level: %v\n", pod.Name, err)
+}
+
+func reconnectBackoff(attempts int) time.Duration {
+	backoff := time.Second << min(max(attempts-1, 0), 5)
+	return min(backoff, maxReconnectBackoff)
+}
+
+func containerStatus(pod corev1.Pod, containerName string) *corev1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == containerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	// Native sidecars report their status as init containers
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == containerName {
+			return &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+func restartCount(pod corev1.Pod, containerName string) int32 {
+	if status := containerStatus(pod, containerName); status != nil {
+		return status.RestartCount
+	}
+	return 0
+}
+
+func isWaiting(pod corev1.Pod, containerName string) bool {
+	status := containerStatus(pod, containerName)
+	return status != nil && status.State.Waiting != nil
+}
@@ -0,0 +1,227 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestFollowLogs_A001(t *testing.T) {
+	pods := []*appv1.Pod{
+		newTestPod("reviews-1", nil, istioContainer),
+		newTestPod("reviews-2", nil, istioContainer),
+	}
+	options := newTestOptions(t, pods...)
+
+	var out bytes.Buffer
+	err := newFollower(&options, []appv1.Pod{*pods[0], *pods[1]}, istioContainer, &out).run()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The fake clientset streams "fake logs" for every pod
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	sort.Strings(lines)
+	expected := []string{
+		"[reviews-1/istio-proxy] fake logs",
+		"[reviews-2/istio-proxy] fake logs",
+	}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected merged output %q", out.String())
+	}
+}
+
+func TestFollowLogs_A002(t *testing.T) {
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	pod.Status.Phase = appv1.PodSucceeded
+	options := newTestOptions(t, pod)
+
+	var out bytes.Buffer
+	f := newFollower(&options, []appv1.Pod{*pod}, istioContainer, &out)
+	f.reconnect = true
+	if err := f.run(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.String() != "fake logs\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+func TestWaitForContainer_A001(t *testing.T) {
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	pod.Status.ContainerStatuses = []appv1.ContainerStatus{{
+		Name:         istioContainer,
+		RestartCount: 2,
+		State:        appv1.ContainerState{Running: &appv1.ContainerStateRunning{}},
+	}}
+	options := newTestOptions(t, pod)
+	f := newFollower(&options, nil, istioContainer, &bytes.Buffer{})
+
+	current, done, err := f.waitForContainer(*pod)
+	if err != nil || done {
+		t.Fatalf("Expected a running container, got done=%v err=%v", done, err)
+	}
+	if restartCount(*current, istioContainer) != 2 {
+		t.Errorf("Unexpected restart count %d", restartCount(*current, istioContainer))
+	}
+
+	err = options.clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, done, err := f.waitForContainer(*pod); err != nil || !done {
+		t.Errorf("Expected following a deleted pod to be done, got done=%v err=%v", done, err)
+	}
+}
+
+func TestSplitTimestamp_A001(t *testing.T) {
+	ts, text, ok := splitTimestamp("2023-08-01T10:00:00.123456789Z [debug] hello world")
+	if !ok || text != "[debug] hello world" {
+		t.Fatalf("Unexpected split %v %q", ok, text)
+	}
+	if !ts.Equal(time.Date(2023, 8, 1, 10, 0, 0, 123456789, time.UTC)) {
+		t.Errorf("Unexpected timestamp %v", ts)
+	}
+
+	if _, text, ok := splitTimestamp("fake logs"); ok || text != "fake logs" {
+		t.Errorf("Line without timestamp was altered to %q", text)
+	}
+}
+
+// redirectOutput sends os.Stdout and os.Stderr to files for the rest of the
+// test and returns a function reading what was written to them
+func redirectOutput(t *testing.T) func() (string, string) {
+	stdout, stderr := os.Stdout, os.Stderr
+	outFile, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	errFile, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	os.Stdout, os.Stderr = outFile, errFile
+	t.Cleanup(func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		outFile.Close()
+		errFile.Close()
+	})
+	return func() (string, string) {
+		out, _ := os.ReadFile(outFile.Name())
+		errOut, _ := os.ReadFile(errFile.Name())
+		return string(out), string(errOut)
+	}
+}
+
+func TestFollowLogs_A003(t *testing.T) {
+	// The fake clientset only streams "fake logs", serve access log entries
+	// from an API server instead
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/unit-test-namespace/pods/reviews-1/log":
+			for i, line := range []string{testTextAccessLog, testTextAccessLog, testJSONAccessLog} {
+				fmt.Fprintf(w, "2023-08-01T10:00:0%d.000000000Z %v\n", i, line)
+			}
+		case "/api/v1/namespaces/unit-test-namespace/pods/reviews-1":
+			// Terminated once the stream ends, so following stops
+			terminated := pod.DeepCopy()
+			terminated.Status.Phase = appv1.PodSucceeded
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(terminated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	options := options{clientset: cs, namespace: "unit-test-namespace"}
+
+	output := redirectOutput(t)
+	err = options.followLogs([]appv1.Pod{*pod}, istioContainer, "debug", StreamOptions{AccessLog: "status>=500", Summary: time.Hour})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	out, errOut := output()
+	if strings.Count(out, "503 UH,URX") != 2 || strings.Contains(out, "ratings") {
+		t.Errorf("Unexpected followed lines %q", out)
+	}
+	for _, expected := range []string{"--- 2 of 3 requests failed in the last 1h0m0s", "reviews:9080/reviews/0", "UH", "URX"} {
+		if !strings.Contains(errOut, expected) {
+			t.Errorf("Expected %q in the summary, got %q", expected, errOut)
+		}
+	}
+}
+
+func TestStreamPod_A001(t *testing.T) {
+	// Envoy writes bursts of lines with the same timestamp
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "2023-08-01T10:00:00.000000000Z first")
+		fmt.Fprintln(w, "2023-08-01T10:00:01.000000000Z second")
+		fmt.Fprintln(w, "2023-08-01T10:00:01.000000000Z third")
+	}))
+	defer server.Close()
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	options := options{clientset: cs, namespace: "unit-test-namespace"}
+	f := newFollower(&options, nil, istioContainer, &bytes.Buffer{})
+	pod := newTestPod("reviews-1", nil, istioContainer)
+
+	var since time.Time
+	var lines []string
+	handle := func(ts time.Time, line string) error {
+		lines = append(lines, line)
+		return nil
+	}
+	if err := f.streamPod(*pod, &since, handle); err != nil {
+		t.Fatal(err.Error())
+	}
+	if strings.Join(lines, ",") != "first,second,third" {
+		t.Errorf("Unexpected lines %q", lines)
+	}
+	if !since.Equal(time.Date(2023, 8, 1, 10, 0, 1, 0, time.UTC)) {
+		t.Errorf("Unexpected since %v", since)
+	}
+
+	// Reconnecting skips the lines up to since
+	lines = nil
+	if err := f.streamPod(*pod, &since, handle); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(lines) != 0 {
+		t.Errorf("Expected the lines already seen to be skipped, got %q", lines)
+	}
+}
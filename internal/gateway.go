@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Istio gateways are labeled istio=<name>, ingressgateway and egressgateway
+// for the default ones, Kubernetes Gateway API ones with the name of their
+// Gateway. Unlike sidecars, Envoy is their main container.
+const istioGatewayLabel = "istio"
+
+var defaultGateways = []string{"ingressgateway", "egressgateway"}
+
+// KubectlIstioLogGateway applies the level spec to every replica of the
+// gateway, or of every gateway when name is empty, in the namespace or in
+// every namespace when allNamespaces is set.
+func (options *options) KubectlIstioLogGateway(name string, allNamespaces bool, logLevel string, follow bool, duration time.Duration, stream StreamOptions) error {
+	if err := stream.validate(); err != nil {
+		return err
+	}
+
+	namespace := options.namespace
+	if allNamespaces {
+		namespace = ""
+	}
+	pods, err := options.gatewayPods(name, namespace)
+	if err != nil {
+		return err
+	}
+	return options.setLogLevels(pods, istioContainer, logLevel, follow, duration, stream)
+}
+
+// gatewayPods returns the pods of the gateway in the namespace, every
+// namespace when empty
+func (opts *options) gatewayPods(name, namespace string) ([]corev1.Pod, error) {
+	var selectors []string
+	if name == "" {
+		selectors = []string{
+			istioGatewayLabel + " in (" + defaultGateways[0] + "," + defaultGateways[1] + ")",
+			gatewayNameLabel,
+		}
+	} else {
+		selectors = []string{
+			istioGatewayLabel + "=" + name,
+			gatewayNameLabel + "=" + name,
+		}
+	}
+
+	var pods []corev1.Pod
+	seen := map[string]bool{}
+	for _, selector := range selectors {
+		result, err := opts.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range result.Items {
+			key := pod.Namespace + "/" + pod.Name
+			if seen[key] || pod.DeletionTimestamp != nil || !hasIstioProxy(pod) {
+				continue
+			}
+			seen[key] = true
+			pods = append(pods, pod)
+		}
+	}
+
+	if len(pods) == 0 {
+		where := "any namespace"
+		if namespace != "" {
+			where = "namespace " + namespace
+		}
+		if name != "" {
+			return nil, fmt.Errorf("no pods of gateway %v found in %v", name, where)
+		}
+		return nil, fmt.Errorf("no gateway pods found in %v", where)
+	}
+	return pods, nil
+}
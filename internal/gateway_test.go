@@ -0,0 +1,92 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newGatewayTestOptions(t *testing.T) options {
+	options := newTestOptions(t,
+		newTestPod("reviews-1", map[string]string{"app": "reviews"}, "app", istioContainer),
+		newTestPod("bookinfo-gateway-1", map[string]string{gatewayNameLabel: "bookinfo-gateway"}, istioContainer),
+	)
+	for _, pod := range []*appv1.Pod{
+		newTestPod("istio-ingressgateway-1", map[string]string{istioGatewayLabel: "ingressgateway"}, istioContainer),
+		newTestPod("istio-ingressgateway-2", map[string]string{istioGatewayLabel: "ingressgateway"}, istioContainer),
+		newTestPod("istio-egressgateway-1", map[string]string{istioGatewayLabel: "egressgateway"}, istioContainer),
+		newTestPod("istiod-1", map[string]string{istioGatewayLabel: "pilot"}, discoveryContainer),
+	} {
+		pod.Namespace = "istio-system"
+		if _, err := options.clientset.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return options
+}
+
+func gatewayPodNames(pods []appv1.Pod) string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestGatewayPods_A001(t *testing.T) {
+	options := newGatewayTestOptions(t)
+
+	pods, err := options.gatewayPods("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := "bookinfo-gateway-1,istio-egressgateway-1,istio-ingressgateway-1,istio-ingressgateway-2"
+	if names := gatewayPodNames(pods); names != expected {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	pods, err = options.gatewayPods("ingressgateway", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if names := gatewayPodNames(pods); names != "istio-ingressgateway-1,istio-ingressgateway-2" {
+		t.Errorf("Unexpected ingress gateway pods %v", names)
+	}
+
+	pods, err = options.gatewayPods("bookinfo-gateway", "unit-test-namespace")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if names := gatewayPodNames(pods); names != "bookinfo-gateway-1" {
+		t.Errorf("Unexpected Gateway API pods %v", names)
+	}
+}
+
+func TestGatewayPods_A002(t *testing.T) {
+	options := newGatewayTestOptions(t)
+
+	if _, err := options.gatewayPods("ingressgateway", "unit-test-namespace"); err == nil {
+		t.Error("Expected no gateway in the namespace")
+	}
+	// istiod is labeled istio=pilot but runs no proxy
+	if _, err := options.gatewayPods("pilot", ""); err == nil {
+		t.Error("Expected pods without a proxy to be left out")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// proxyLogLevels is the level of every logger of a single proxy
+type proxyLogLevels struct {
+	Pod       string      `json:"pod"`
+	Namespace string      `json:"namespace"`
+	Loggers   logSnapshot `json:"loggers"`
+}
+
+// KubectlIstioLogGet prints the current per-logger levels of every targeted
+// proxy as a table, json or yaml.
+func (options *options) KubectlIstioLogGet(target Target, output string) error {
+	if output != "table" && output != "json" && output != "yaml" {
+		return fmt.Errorf("unsupported output format: %v", output)
+	}
+
+	pods, err := options.getPods(target)
+	if err != nil {
+		return err
+	}
+
+	snapshots := make([]logSnapshot, len(pods))
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		snapshots[i], errs[i] = podSnapshot(pod)
+	})
+
+	var proxies []proxyLogLevels
+	failed := 0
+	for i, pod := range pods {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", pod.Name, errs[i])
+			failed++
+			continue
+		}
+		proxies = append(proxies, proxyLogLevels{
+			Pod:       pod.Name,
+			Namespace: pod.Namespace,
+			Loggers:   snapshots[i],
+		})
+	}
+
+	if len(proxies) > 0 {
+		if err := printLogLevels(os.Stdout, proxies, output); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to get log levels of %d of %d pods", failed, len(pods))
+	}
+	return nil
+}
+
+func printLogLevels(out io.Writer, proxies []proxyLogLevels, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(proxies, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(proxies)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	default:
+		return printLogLevelsTable(out, proxies)
+	}
+}
+
+// printLogLevelsTable prints a row per proxy with the level shared by most of
+// its loggers and the loggers that deviate from it, which makes proxies that
+// drifted from the default level stand out. A single proxy gets a row per
+// logger instead, like `istioctl proxy-config log`.
+func printLogLevelsTable(out io.Writer, proxies []proxyLogLevels) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	if len(proxies) == 1 {
+		fmt.Fprintln(w, "LOGGER\tLEVEL")
+		for _, ll := range proxies[0].Loggers {
+			fmt.Fprintf(w, "%v\t%v\n", ll.Name, ll.Level)
+		}
+		return w.Flush()
+	}
+
+	fmt.Fprintln(w, "POD\tNAMESPACE\tLEVEL\tOVERRIDES")
+	for _, proxy := range proxies {
+		common := proxy.Loggers.commonLevel()
+		var overrides []string
+		for _, ll := range proxy.Loggers.overrides(common) {
+			overrides = append(overrides, ll.Name+":"+ll.Level.String())
+		}
+		if len(overrides) == 0 {
+			overrides = []string{"<none>"}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", proxy.Pod, proxy.Namespace, common, strings.Join(overrides, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,145 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appv1 "k8s.io/api/core/v1"
+)
+
+func testProxies(t *testing.T) []proxyLogLevels {
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return []proxyLogLevels{{Pod: "reviews-1", Namespace: "bookinfo", Loggers: snapshot}}
+}
+
+func TestPrintLogLevels_A001(t *testing.T) {
+	proxies := testProxies(t)
+	proxies = append(proxies, proxyLogLevels{Pod: "reviews-2", Namespace: "bookinfo", Loggers: proxies[0].Loggers})
+	var out bytes.Buffer
+	if err := printLogLevels(&out, proxies, "table"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and a row per proxy, got %q", out.String())
+	}
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) != 4 ||
+			fields[2] != "info" || fields[3] != "admin:warning,http:debug,upstream:warning" {
+			t.Errorf("Unexpected row %q", line)
+		}
+	}
+}
+
+func TestPrintLogLevels_A002(t *testing.T) {
+	var out bytes.Buffer
+	if err := printLogLevels(&out, testProxies(t), "json"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(out.String(), `"name": "http",`) || !strings.Contains(out.String(), `"level": "debug"`) {
+		t.Errorf("Unexpected json output %v", out.String())
+	}
+
+	out.Reset()
+	if err := printLogLevels(&out, testProxies(t), "yaml"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(out.String(), "- level: debug\n    name: http\n") {
+		t.Errorf("Unexpected yaml output %v", out.String())
+	}
+}
+
+func TestPrintLogLevels_A003(t *testing.T) {
+	var out bytes.Buffer
+	if err := printLogLevels(&out, testProxies(t), "table"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// A single proxy lists every logger
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var rows []string
+	for _, line := range lines {
+		rows = append(rows, strings.Join(strings.Fields(line), " "))
+	}
+	expected := []string{
+		"LOGGER LEVEL",
+		"admin warning",
+		"connection info",
+		"http debug",
+		"rbac info",
+		"router info",
+		"upstream warning",
+	}
+	if strings.Join(rows, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected rows %q", rows)
+	}
+}
+
+func TestKubectlIstioLogGet_A001(t *testing.T) {
+	var pods []*appv1.Pod
+	for _, name := range []string{"reviews-1", "reviews-2", "reviews-3"} {
+		pods = append(pods, newTestPod(name, map[string]string{"app": "reviews"}, istioContainer))
+	}
+	options := newTestOptions(t, pods...)
+
+	// Every proxy only answers once all of them were asked, which they
+	// aren't when pods are read one at a time
+	var asked sync.WaitGroup
+	asked.Add(len(pods))
+	all := make(chan struct{})
+	go func() {
+		asked.Wait()
+		close(all)
+	}()
+	for _, pod := range pods {
+		testProxy(t, pod.Name, pod.Namespace, func(w http.ResponseWriter, r *http.Request) {
+			asked.Done()
+			select {
+			case <-all:
+				fmt.Fprint(w, testLoggingResponse)
+			case <-time.After(5 * time.Second):
+				http.Error(w, "pods read one at a time", http.StatusServiceUnavailable)
+			}
+		})
+	}
+
+	output := redirectOutput(t)
+	if err := options.KubectlIstioLogGet(Target{Selector: "app=reviews"}, "json"); err != nil {
+		t.Fatal(err.Error())
+	}
+	out, _ := output()
+	var proxies []proxyLogLevels
+	if err := json.Unmarshal([]byte(out), &proxies); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(proxies) != len(pods) {
+		t.Fatalf("Expected every pod, got %v", out)
+	}
+	for i, proxy := range proxies {
+		if proxy.Pod != pods[i].Name || len(proxy.Loggers) == 0 {
+			t.Errorf("Unexpected proxy %d %v", i, proxy)
+		}
+	}
+}
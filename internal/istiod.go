@@ -0,0 +1,260 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	istiodLabel        = "app"
+	istiodLabelValue   = "istiod"
+	discoveryContainer = "discovery"
+	// controlzPort serves istiod's ControlZ introspection API, through
+	// which `istioctl admin log` changes the levels of its scopes
+	controlzPort = 9876
+)
+
+// scopeInfo is a logging scope as served by ControlZ on /scopej
+type scopeInfo struct {
+	Name            string `json:"name"`
+	Description     string `json:"description,omitempty"`
+	OutputLevel     string `json:"output_level"`
+	StackTraceLevel string `json:"stack_trace_level,omitempty"`
+	LogCallers      bool   `json:"log_callers"`
+}
+
+// Istio scopes have no trace level, and name the critical and off levels
+// fatal and none.
+var istiodLevels = map[Level]string{
+	TraceLevel:    "debug",
+	DebugLevel:    "debug",
+	InfoLevel:     "info",
+	WarningLevel:  "warn",
+	ErrorLevel:    "error",
+	CriticalLevel: "fatal",
+	OffLevel:      "none",
+}
+
+var istiodLevelNames = map[string]Level{
+	"debug": DebugLevel,
+	"info":  InfoLevel,
+	"warn":  WarningLevel,
+	"error": ErrorLevel,
+	"fatal": CriticalLevel,
+	"none":  OffLevel,
+}
+
+func isIstiod(pod corev1.Pod) bool {
+	return pod.Labels[istiodLabel] == istiodLabelValue
+}
+
+// KubectlIstioLogIstiod changes the levels of the scopes of the istiod pods
+// of the revision, follows their logs and reverts the levels on exit.
+func (options *options) KubectlIstioLogIstiod(revision, istioNamespace, logLevel string, stream StreamOptions) error {
+	if err := stream.validate(); err != nil {
+		return err
+	}
+
+	pods, err := istiodPods(revision, istioNamespace)
+	if err != nil {
+		return err
+	}
+	return options.setLogLevels(pods, discoveryContainer, logLevel, true, 0, stream)
+}
+
+// istiodPods returns the running istiod pods of the revision, or of every
+// revision when it is empty
+func istiodPods(revision, istioNamespace string) ([]corev1.Pod, error) {
+	kubeClient, err := newKubeClientWithRevision(clientConfig, revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	result, err := kubeClient.GetIstioPods(context.TODO(), istioNamespace, metav1.ListOptions{
+		LabelSelector: istiodLabel + "=" + istiodLabelValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range result {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		if revision != "" {
+			return nil, fmt.Errorf("no running istiod pods of revision %v found in namespace %v", revision, istioNamespace)
+		}
+		return nil, fmt.Errorf("no running istiod pods found in namespace %v", istioNamespace)
+	}
+	return pods, nil
+}
+
+// controlzClient talks to the ControlZ API of an istiod pod through the
+// pod's admin connection
+type controlzClient struct {
+	conn *adminConn
+}
+
+func newControlzClient(pod, namespace string) *controlzClient {
+	return &controlzClient{conn: getAdminConn("ControlZ", pod, namespace, controlzPort)}
+}
+
+func (c *controlzClient) do(method, path string, body []byte) ([]byte, error) {
+	return c.conn.do(method, path, body)
+}
+
+func (c *controlzClient) scopes() ([]scopeInfo, error) {
+	data, err := c.do(http.MethodGet, "/scopej/", nil)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []scopeInfo
+	if err := json.Unmarshal(data, &scopes); err != nil {
+		return nil, fmt.Errorf("unexpected ControlZ scopes response: %v", err)
+	}
+	return scopes, nil
+}
+
+// setScope updates the scope as a whole, so its other settings are sent back
+// unchanged
+func (c *controlzClient) setScope(scope scopeInfo) error {
+	data, err := json.Marshal(scope)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodPut, "/scopej/"+scope.Name, data)
+	return err
+}
+
+// setIstiodLogLevel applies the level spec to the scopes of istiod, scope
+// names being validated against the ones it reports.
+func setIstiodLogLevel(logLevel, pod, namespace string) (string, error) {
+	client := newControlzClient(pod, namespace)
+
+	scopes, err := client.scopes()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, scope.Name)
+	}
+	spec, err := parseLevelSpec(logLevel, names)
+	if err != nil {
+		return "", err
+	}
+	levels, err := spec.resolve(func() (logSnapshot, error) { return istiodSnapshot(scopes) })
+	if err != nil {
+		return "", err
+	}
+
+	changed := istiodScopeChanges(scopes, levels.levels())
+	for _, scope := range changed {
+		if err := client.setScope(scope); err != nil {
+			return "", err
+		}
+	}
+	return formatIstiodScopes(scopes, changed), nil
+}
+
+// istiodScopeChanges returns the scopes whose level differs from the one
+// requested. The level logger applies to every scope, then named scopes
+// override it.
+func istiodScopeChanges(scopes []scopeInfo, levels map[string]Level) []scopeInfo {
+	var changed []scopeInfo
+	for _, scope := range scopes {
+		ll, ok := levels[scope.Name]
+		if !ok {
+			ll, ok = levels[defaultLoggerName]
+		}
+		if !ok || istiodLevels[ll] == scope.OutputLevel {
+			continue
+		}
+		scope.OutputLevel = istiodLevels[ll]
+		changed = append(changed, scope)
+	}
+	return changed
+}
+
+// formatIstiodScopes lists the levels of the scopes once changed, the way
+// Envoy lists its loggers
+func formatIstiodScopes(scopes, changed []scopeInfo) string {
+	levels := map[string]string{}
+	for _, scope := range changed {
+		levels[scope.Name] = scope.OutputLevel
+	}
+	var b strings.Builder
+	b.WriteString("active scopes:\n")
+	for _, scope := range scopes {
+		level, ok := levels[scope.Name]
+		if !ok {
+			level = scope.OutputLevel
+		}
+		fmt.Fprintf(&b, "  %v: %v\n", scope.Name, level)
+	}
+	return b.String()
+}
+
+// getIstiodSnapshot reads the current levels of the scopes of istiod
+func getIstiodSnapshot(pod, namespace string) (logSnapshot, error) {
+	client := newControlzClient(pod, namespace)
+
+	scopes, err := client.scopes()
+	if err != nil {
+		return nil, err
+	}
+	return istiodSnapshot(scopes)
+}
+
+func istiodSnapshot(scopes []scopeInfo) (logSnapshot, error) {
+	snapshot := make(logSnapshot, 0, len(scopes))
+	for _, scope := range scopes {
+		level, ok := istiodLevelNames[scope.OutputLevel]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized logging level of scope %v: %v", scope.Name, scope.OutputLevel)
+		}
+		snapshot = append(snapshot, loggerLevel{Name: scope.Name, Level: level})
+	}
+	if len(snapshot) == 0 {
+		return nil, fmt.Errorf("no scopes in ControlZ response")
+	}
+	return snapshot, nil
+}
+
+// restoreIstiod sets the scopes of istiod back to the snapshot
+func (s logSnapshot) restoreIstiod(pod, namespace string) error {
+	client := newControlzClient(pod, namespace)
+
+	scopes, err := client.scopes()
+	if err != nil {
+		return err
+	}
+	for _, scope := range istiodScopeChanges(scopes, s.levels()) {
+		if err := client.setScope(scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+)
+
+var testScopes = []scopeInfo{
+	{Name: "ads", OutputLevel: "info", StackTraceLevel: "none", LogCallers: true},
+	{Name: "default", OutputLevel: "info", StackTraceLevel: "none"},
+	{Name: "model", OutputLevel: "warn", StackTraceLevel: "none"},
+}
+
+func TestIstiodScopeChanges_A001(t *testing.T) {
+	levels := specLevels(t, "debug,model:error", []string{"ads", "default", "model"})
+	changed := istiodScopeChanges(testScopes, levels)
+	if len(changed) != 3 {
+		t.Fatalf("Expected every scope to change, got %v", changed)
+	}
+	if changed[0].OutputLevel != "debug" || !changed[0].LogCallers || changed[0].StackTraceLevel != "none" {
+		t.Errorf("Expected the other settings of the scope to be kept, got %+v", changed[0])
+	}
+	if changed[2].OutputLevel != "error" {
+		t.Errorf("Expected the scope level to override the default one, got %+v", changed[2])
+	}
+
+	// Scopes already at the requested level are left alone
+	changed = istiodScopeChanges(testScopes, map[string]Level{"ads": TraceLevel, "model": WarningLevel})
+	if len(changed) != 1 || changed[0].Name != "ads" || changed[0].OutputLevel != "debug" {
+		t.Errorf("Unexpected changes %v", changed)
+	}
+
+	if _, err := parseLevelSpec("adz:debug", []string{"ads", "default", "model"}); err == nil {
+		t.Error("Expected an unknown scope to be rejected")
+	}
+}
+
+func TestIstiodSnapshot_A001(t *testing.T) {
+	snapshot, err := istiodSnapshot(testScopes)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(snapshot) != 3 || snapshot[0].Level != InfoLevel || snapshot[2].Level != WarningLevel {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+
+	// Restoring the snapshot changes nothing on unchanged scopes
+	levels := map[string]Level{}
+	for _, ll := range snapshot {
+		levels[ll.Name] = ll.Level
+	}
+	if changed := istiodScopeChanges(testScopes, levels); len(changed) != 0 {
+		t.Errorf("Expected no changes, got %v", changed)
+	}
+
+	if _, err := istiodSnapshot([]scopeInfo{{Name: "ads", OutputLevel: "loud"}}); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
+
+func TestFormatIstiodScopes_A001(t *testing.T) {
+	out := formatIstiodScopes(testScopes, []scopeInfo{{Name: "ads", OutputLevel: "debug"}})
+	expected := "active scopes:\n  ads: debug\n  default: info\n  model: warn\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestIsIstiod_A001(t *testing.T) {
+	if !isIstiod(*newTestPod("istiod-1", map[string]string{"app": "istiod"}, discoveryContainer)) {
+		t.Error("Expected an istiod pod")
+	}
+	if isIstiod(*newTestPod("reviews-1", map[string]string{"app": "reviews"}, istioContainer)) {
+		t.Error("Expected a sidecar pod")
+	}
+}
@@ -16,23 +16,28 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/signal"
-	"regexp"
 	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"istio.io/istio/pkg/kube"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
-	kubeClient    = newKubeClient
-	kubeconfig    string
-	configContext string
+	kubeClient = newKubeClient
+	// clientConfig is the kubeconfig of the Istio client, set by GetOpts to
+	// the one of the Kubernetes client
+	clientConfig = kube.BuildClientCmd("", "")
 )
 
 type Level int
@@ -42,37 +47,57 @@ const (
 	defaultOutputLevel = WarningLevel
 )
 
+// allLoggers is the list of Envoy loggers used to validate logger names when
+// the loggers of the target proxy can't be discovered.
 var allLoggers = []string{
 	"admin",
+	"alternate_protocols_cache",
 	"aws",
 	"assert",
 	"backtrace",
+	"basic_auth",
+	"cache_filter",
 	"client",
 	"config",
 	"connection",
 	"conn_handler", // Added through https://github.com/envoyproxy/envoy/pull/8263
+	"compression",
+	"decompression",
+	"dns",
 	"dubbo",
+	"envoy_bug",
+	"ext_authz",
+	"ext_proc",
 	"file",
 	"filter",
 	"forward_proxy",
+	"golang",
 	"grpc",
+	"happy_eyeballs",
 	"hc",
 	"health_checker",
 	"http",
 	"http2",
-	"hystrix",
+	"http3",
 	"init",
 	"io",
 	"jwt",
 	"kafka",
+	"key_value_store",
 	"lua",
 	"main",
+	"matcher",
 	"misc",
 	"mongo",
+	"multi_connection",
+	"oauth2",
 	"quic",
+	"quic_stream",
 	"pool",
 	"rbac",
+	"rds",
 	"redis",
+	"rocketmq",
 	"router",
 	"runtime",
 	"stats",
@@ -84,6 +109,7 @@ var allLoggers = []string{
 	"upstream",
 	"udp",
 	"wasm",
+	"websocket",
 }
 
 var levelToString = map[Level]string{
@@ -96,6 +122,25 @@ var levelToString = map[Level]string{
 	OffLevel:      "off",
 }
 
+func (l Level) String() string {
+	return levelToString[l]
+}
+
+// MarshalText renders the level by name, as used by Envoy
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses a level by name
+func (l *Level) UnmarshalText(text []byte) error {
+	level, ok := stringToLevel[string(text)]
+	if !ok {
+		return fmt.Errorf("unrecognized logging level: %v", string(text))
+	}
+	*l = level
+	return nil
+}
+
 var stringToLevel = map[string]Level{
 	"trace":    TraceLevel,
 	"debug":    DebugLevel,
@@ -125,96 +170,48 @@ const (
 )
 
 func (opts *options) isPodExists(podName string) error {
-	result, err := opts.clientset.CoreV1().Pods(opts.namespace).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
+	_, err := opts.getPod(podName)
+	return err
+}
 
-	for _, pod := range result.Items {
-		if pod.Name == podName {
-			return nil
+func (opts *options) getPod(podName string) (*corev1.Pod, error) {
+	pod, err := opts.clientset.CoreV1().Pods(opts.namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%v Pod doesn't exist", podName)
 		}
+		return nil, err
 	}
-
-	return fmt.Errorf("%v Pod doesn't exist", podName)
+	return pod, nil
 }
 
-func newKubeClientWithRevision(kubeconfig, configContext string, revision string) (kube.CLIClient, error) {
-	return kube.NewCLIClient(kube.BuildClientCmd(kubeconfig, configContext), revision)
+func newKubeClientWithRevision(clientConfig clientcmd.ClientConfig, revision string) (kube.CLIClient, error) {
+	return kube.NewCLIClient(clientConfig, revision)
 }
 
-func newKubeClient(kubeconfig, configContext string) (kube.CLIClient, error) {
-	return newKubeClientWithRevision(kubeconfig, configContext, "")
+func newKubeClient(clientConfig clientcmd.ClientConfig) (kube.CLIClient, error) {
+	return newKubeClientWithRevision(clientConfig, "")
 }
 
 func setupEnvoyLog(param, pod, namespace string) (string, error) {
-	kubeClient, err := kubeClient(kubeconfig, configContext)
-	if err != nil {
-		return "", fmt.Errorf("failed to create Kubernetes client: %v", err)
-	}
 	path := "logging"
 	if param != "" {
 		path = path + "?" + param
 	}
-	result, err := kubeClient.EnvoyDo(context.TODO(), pod, namespace, "POST", path)
+	result, err := envoyAdmin("POST", path, pod, namespace)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute command on Envoy: %v", err)
+		return "", err
 	}
 	return string(result), nil
 }
 
-func handleLog(logLevel string, pod string, namespace string) error {
-	destLoggerLevels := map[string]Level{}
-
-	levels := strings.Split(logLevel, ",")
-	for _, ol := range levels {
-		if !strings.Contains(ol, ":") && !strings.Contains(ol, "=") {
-			level, ok := stringToLevel[ol]
-			if ok {
-				destLoggerLevels = map[string]Level{
-					defaultLoggerName: level,
-				}
-			} else {
-				return fmt.Errorf("unrecognized logging level: %v", ol)
-			}
-		} else {
-			invalidLogName := true
-			loggerLevel := regexp.MustCompile(`[:=]`).Split(ol, 2)
-
-			for _, logName := range allLoggers {
-				if logName == loggerLevel[0] {
-					invalidLogName = false
-					break
-				}
-			}
-
-			if invalidLogName {
-				return fmt.Errorf("unrecognized logger name: %v", loggerLevel[0])
-			}
-
-			level, ok := stringToLevel[loggerLevel[1]]
-			if !ok {
-				return fmt.Errorf("unrecognized logging level: %v", loggerLevel[1])
-			}
-			destLoggerLevels[loggerLevel[0]] = level
-		}
-	}
-
-	var resp string
-	var err error
+// envoyAdmin sends a request to the admin API of the pod's proxy
+func envoyAdmin(method, path, pod, namespace string) ([]byte, error) {
+	return getAdminConn("Envoy", pod, namespace, envoyAdminPort).do(method, path, nil)
+}
 
-	if len(destLoggerLevels) == 0 {
-		resp, err = setupEnvoyLog("", pod, namespace)
-	} else {
-		if ll, ok := destLoggerLevels[defaultLoggerName]; ok {
-			// update levels of all loggers first
-			resp, err = setupEnvoyLog(defaultLoggerName+"="+levelToString[ll], pod, namespace)
-			delete(destLoggerLevels, defaultLoggerName)
-		}
-		for lg, ll := range destLoggerLevels {
-			resp, err = setupEnvoyLog(lg+"="+levelToString[ll], pod, namespace)
-		}
-	}
+func handleLog(logLevel string, pod string, namespace string) error {
+	resp, err := setEnvoyLogLevel(logLevel, pod, namespace)
 	if err != nil {
 		return err
 	}
@@ -222,67 +219,201 @@ func handleLog(logLevel string, pod string, namespace string) error {
 	return nil
 }
 
-func (opts *options) streamLogs(podName string, containerName string) error {
-	count := int64(1)
-	podLogOptions := corev1.PodLogOptions{
-		Container: containerName,
-		Follow:    true,
-		TailLines: &count,
+// setEnvoyLogLevel applies the level spec to the Envoy of the pod
+func setEnvoyLogLevel(logLevel, pod, namespace string) (string, error) {
+	current := lazySnapshot(pod, namespace)
+	spec, err := parseLevelSpec(logLevel, proxyLoggers(logLevel, pod, current))
+	if err != nil {
+		return "", err
 	}
-
-	req := opts.clientset.CoreV1().Pods(opts.namespace).GetLogs(podName, &podLogOptions)
-	stream, err := req.Stream(context.TODO())
+	levels, err := spec.resolve(current)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer stream.Close()
-	for {
-		buf := make([]byte, 2000)
-		numBytes, err := stream.Read(buf)
-		if numBytes == 0 {
+	return applyLogLevels(levels, pod, namespace)
+}
+
+// applyLogLevels sends the logging requests setting the levels, reporting
+// every failed request, and returns the loggers listed by the last one.
+func applyLogLevels(levels logSnapshot, pod string, namespace string) (string, error) {
+	var resp string
+	var errs []error
+	for _, param := range envoyLogParams(levels) {
+		r, err := setupEnvoyLog(param, pod, namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", param, err))
 			continue
 		}
-		if err == io.EOF {
-			break
+		resp = r
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return resp, nil
+}
+
+// envoyLogParams returns the fewest logging requests setting the levels:
+// the level of every logger first, then every other logger at once as
+// paths, logger names or the path globs of fine-grain logging alike. Without
+// levels, the single request lists the loggers.
+func envoyLogParams(levels logSnapshot) []string {
+	var params, paths []string
+	for _, ll := range levels {
+		if ll.Name == defaultLoggerName {
+			params = append(params, defaultLoggerName+"="+ll.Level.String())
+		} else {
+			paths = append(paths, ll.Name+":"+ll.Level.String())
 		}
-		if err != nil {
-			return err
+	}
+	if len(paths) > 0 {
+		params = append(params, "paths="+strings.Join(paths, ","))
+	}
+	if len(params) == 0 {
+		return []string{""}
+	}
+	return params
+}
+
+// handleLogs applies the log level to every pod and reports the outcome of
+// each one in a table.
+func handleLogs(logLevel string, pods []corev1.Pod) error {
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		_, errs[i] = setPodLogLevel(logLevel, pod)
+	})
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "POD\tNAMESPACE\tRESULT")
+	for i, pod := range pods {
+		result := "ok"
+		if errs[i] != nil {
+			// Keep every failure of the pod on its row
+			result = strings.ReplaceAll(errs[i].Error(), "\n", "; ")
+			failed++
 		}
-		message := string(buf[:numBytes])
-		fmt.Print(message)
+		fmt.Fprintf(w, "%v\t%v\t%v\n", pod.Name, pod.Namespace, result)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update log level on %d of %d pods", failed, len(pods))
 	}
 	return nil
 }
 
-func (options *options) KubectlIstioLog(pod string, logLevel string, follow bool) error {
-	err := options.isPodExists(pod)
+func (options *options) KubectlIstioLog(target Target, logLevel string, follow bool, duration time.Duration, stream StreamOptions) error {
+	if err := stream.validate(); err != nil {
+		return err
+	}
+
+	pods, err := options.getPods(target)
 	if err != nil {
 		return err
 	}
+	return options.setLogLevels(pods, istioContainer, logLevel, follow, duration, stream)
+}
+
+// setLogLevels applies the level spec to the proxies of the pods. When
+// following their container logs or raising the levels for a limited time,
+// the levels are reverted once done.
+func (options *options) setLogLevels(pods []corev1.Pod, container, logLevel string, follow bool, duration time.Duration, stream StreamOptions) error {
+	// Logger names are validated per proxy, catch bad levels upfront
+	if _, err := parseLevelSpec(logLevel, nil); err != nil {
+		return err
+	}
+
+	// Keep the current levels around to put them back once we are done
+	revert := follow || duration > 0
+	if stream.StatsDiff && !revert {
+		return fmt.Errorf("--stats-diff requires --follow or --duration")
+	}
+	snapshots := map[string]logSnapshot{}
+	if revert {
+		list := make([]logSnapshot, len(pods))
+		errs := make([]error, len(pods))
+		forEachPod(pods, func(i int, pod corev1.Pod) {
+			list[i], errs[i] = originalSnapshot(pod)
+		})
+		for i, pod := range pods {
+			if errs[i] != nil {
+				return errs[i]
+			}
+			snapshots[pod.Namespace+"/"+pod.Name] = list[i]
+		}
+	}
 
-	err = handleLog(logLevel, pod, options.namespace)
+	var err error
+	if len(pods) == 1 {
+		err = handlePodLog(logLevel, pods[0])
+	} else {
+		err = handleLogs(logLevel, pods)
+	}
 	if err != nil {
 		return err
 	}
 
-	if follow {
-		c := make(chan os.Signal)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	if !revert {
+		return nil
+	}
+
+	var stats map[string]counters
+	if stream.StatsDiff {
+		stats = statsSnapshot(pods)
+	}
+	var once sync.Once
+	var finishErr error
+	finish := func() error {
+		once.Do(func() {
+			if stats != nil {
+				printStatsDiff(os.Stdout, pods, stats)
+			}
+			finishErr = options.restorePods(pods, snapshots, duration > 0)
+		})
+		return finishErr
+	}
+
+	// Record the revert on the pods, so that `reap` reverts the levels
+	// should we not get to it
+	var expired <-chan time.Time
+	if duration > 0 {
+		revertAt := time.Now().Add(duration)
+		for _, pod := range pods {
+			if err := options.recordRevert(pod, snapshots[pod.Namespace+"/"+pod.Name], revertAt); err != nil {
+				return errors.Join(err, options.restorePods(pods, snapshots, true))
+			}
+		}
+		expired = time.After(duration)
+		fmt.Fprintf(os.Stderr, "Log levels will be reverted at %v\n", revertAt.Format(time.RFC3339))
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	if follow {
+		f, err := options.newLogFollower(pods, container, logLevel, stream)
+		if err != nil {
+			return errors.Join(err, finish())
+		}
 		go func() {
-			<-c
-			err := handleLog(levelToString[defaultOutputLevel], pod, options.namespace)
-			if err != nil {
-				fmt.Print(err)
+			select {
+			case <-c:
+			case <-expired:
+			}
+			// The lines held back and the last summary would be lost on exit
+			if err := errors.Join(f.drain(), finish()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
 			}
 			os.Exit(0)
 		}()
 
-		err := options.streamLogs(pod, istioContainer)
-		if err != nil {
-			return err
-		}
+		return errors.Join(f.follow(), finish())
 	}
 
-	return nil
+	select {
+	case <-c:
+	case <-expired:
+	}
+	return finish()
 }
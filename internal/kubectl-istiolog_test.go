@@ -14,6 +14,7 @@ package internal
 
 import (
 	"context"
+	"reflect"
 	"regexp"
 	"testing"
 
@@ -76,7 +77,7 @@ func TestIstioLogGetPod_A001(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = options.KubectlIstioLog("unit-test-pod1", "debug", false)
+	err = options.KubectlIstioLog(Target{Pod: "unit-test-pod1"}, "debug", false, 0, StreamOptions{})
 	if err == nil {
 		t.Errorf("Error during reterving pod that doesn't exist")
 	}
@@ -110,7 +111,7 @@ func TestIstioLoggerName_A001(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = options.KubectlIstioLog("unit-test-pod", "hello", false)
+	err = options.KubectlIstioLog(Target{Pod: "unit-test-pod"}, "hello", false, 0, StreamOptions{})
 	if err == nil {
 		t.Errorf("Error while using illegal loggerName")
 	}
@@ -136,7 +137,7 @@ func TestIstioLoggerName_A002(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = options.KubectlIstioLog("unit-test-pod", "debug", false)
+	err = options.KubectlIstioLog(Target{Pod: "unit-test-pod"}, "debug", false, 0, StreamOptions{})
 
 	if !successfullyParsedLoggerNameAndLevel(err) {
 		t.Errorf("Error while using illegal loggerLevel")
@@ -157,7 +158,7 @@ func TestIstioLoggerLevel_A001(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = options.KubectlIstioLog("unit-test-pod", "debug:hello", false)
+	err = options.KubectlIstioLog(Target{Pod: "unit-test-pod"}, "debug:hello", false, 0, StreamOptions{})
 	if err == nil {
 		t.Errorf("Error while using illegal loggerLevel")
 	}
@@ -177,8 +178,26 @@ func TestIstioLoggerLevel_A002(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = options.KubectlIstioLog("unit-test-pod", "http:debug", false)
+	err = options.KubectlIstioLog(Target{Pod: "unit-test-pod"}, "http:debug", false, 0, StreamOptions{})
 	if !successfullyParsedLoggerNameAndLevel(err) {
 		t.Errorf("Error while using illegal loggerName")
 	}
 }
+
+func TestEnvoyLogParams_A001(t *testing.T) {
+	levels := logSnapshot{{"level", InfoLevel}, {"router", TraceLevel}, {"http", DebugLevel}, {"rbac", OffLevel}}
+	expected := []string{"level=info", "paths=router:trace,http:debug,rbac:off"}
+	if params := envoyLogParams(levels); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Unexpected params %v", params)
+	}
+
+	levels = logSnapshot{{"source/common/http/*", DebugLevel}, {"source/common/router/*", TraceLevel}}
+	expected = []string{"paths=source/common/http/*:debug,source/common/router/*:trace"}
+	if params := envoyLogParams(levels); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Unexpected params %v", params)
+	}
+
+	if params := envoyLogParams(nil); !reflect.DeepEqual(params, []string{""}) {
+		t.Errorf("Unexpected params %v", params)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A level spec is a comma-separated list of terms:
+//
+//	debug               level of every logger, same as *=debug or *:debug
+//	http:debug          level of a logger, same as http=debug
+//	-http               reset a logger to the default level
+//	mtls                levels of a named log profile
+//
+// Like Envoy's level= parameter, the level of every logger applies first
+// wherever it is given, then the loggers are set in the order given.
+
+// levelSpec is a parsed level spec
+type levelSpec struct {
+	// All is the level of every logger, when AllSet
+	All    Level
+	AllSet bool
+	// Loggers are the per-logger terms in the order given
+	Loggers []loggerTerm
+}
+
+// loggerTerm sets a logger to a level, or resets it to the default level
+type loggerTerm struct {
+	Name  string
+	Level Level
+	Reset bool
+	// Profile is the log profile the term comes from, if any
+	Profile string
+}
+
+func (t loggerTerm) String() string {
+	value := t.Level.String()
+	if t.Reset {
+		value = "reset"
+	}
+	if t.Profile != "" {
+		value += " (profile " + t.Profile + ")"
+	}
+	return value
+}
+
+// parseLevelSpec parses a level spec, reporting every invalid term at once.
+// Logger names are validated against loggers unless it is nil. A logger
+// given twice with different levels is a conflict, except that loggers given
+// explicitly override the ones of profiles.
+func parseLevelSpec(logLevel string, loggers []string) (levelSpec, error) {
+	var spec levelSpec
+	var errs []error
+	for _, term := range strings.Split(logLevel, ",") {
+		errs = append(errs, spec.parseTerm(term, loggers)...)
+	}
+	if len(errs) > 0 {
+		return levelSpec{}, errors.Join(errs...)
+	}
+	return spec, nil
+}
+
+func (s *levelSpec) parseTerm(term string, loggers []string) []error {
+	if term == "" {
+		return []error{fmt.Errorf("empty term in level spec")}
+	}
+	if level, ok := stringToLevel[term]; ok {
+		return errorList(s.setAll(level))
+	}
+
+	if name, ok := strings.CutPrefix(term, "-"); ok {
+		if name == "" || name == "*" || name == defaultLoggerName {
+			return []error{fmt.Errorf("invalid reset %v, expected -<logger>", term)}
+		}
+		if err := validateTermLogger(name, loggers); err != nil {
+			return []error{err}
+		}
+		return errorList(s.addLogger(loggerTerm{Name: name, Reset: true}))
+	}
+
+	// Split on the last separator, as ztunnel scopes may contain ::
+	i := strings.LastIndexAny(term, ":=")
+	if i < 0 {
+		return s.addProfile(term, loggers)
+	}
+	name, value := term[:i], term[i+1:]
+	level, ok := stringToLevel[value]
+	if !ok {
+		return []error{fmt.Errorf("unrecognized logging level: %v", value)}
+	}
+	switch name {
+	case "":
+		return []error{fmt.Errorf("missing logger name in %v", term)}
+	case "*", defaultLoggerName:
+		return errorList(s.setAll(level))
+	}
+	if err := validateTermLogger(name, loggers); err != nil {
+		return []error{err}
+	}
+	return errorList(s.addLogger(loggerTerm{Name: name, Level: level}))
+}
+
+// addProfile adds the loggers of the profile, sorted by name
+func (s *levelSpec) addProfile(name string, loggers []string) []error {
+	profile, err := getProfile(name)
+	if err != nil {
+		return []error{err}
+	}
+	names := make([]string, 0, len(profile))
+	for lg := range profile {
+		names = append(names, lg)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, lg := range names {
+		if err := validateTermLogger(lg, loggers); err != nil {
+			errs = append(errs, fmt.Errorf("profile %v: %v", name, err))
+			continue
+		}
+		if err := s.addLogger(loggerTerm{Name: lg, Level: profile[lg], Profile: name}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (s *levelSpec) setAll(level Level) error {
+	if s.AllSet && s.All != level {
+		return fmt.Errorf("conflicting levels for every logger: %v and %v", s.All, level)
+	}
+	s.All, s.AllSet = level, true
+	return nil
+}
+
+func (s *levelSpec) addLogger(term loggerTerm) error {
+	for i, t := range s.Loggers {
+		if t.Name != term.Name {
+			continue
+		}
+		switch {
+		case t.Level == term.Level && t.Reset == term.Reset:
+			return nil
+		case t.Profile != "" && term.Profile == "":
+			s.Loggers[i] = term
+			return nil
+		case t.Profile == "" && term.Profile != "":
+			return nil
+		}
+		return fmt.Errorf("conflicting levels for logger %v: %v and %v", term.Name, t, term)
+	}
+	s.Loggers = append(s.Loggers, term)
+	return nil
+}
+
+// resolve returns the levels to apply: the level of every logger first, as
+// the level logger, then the loggers in the order given. Reset loggers get
+// the level of every logger or, when the spec doesn't set it, the default
+// level of the proxy, which is only then read with current.
+func (s levelSpec) resolve(current func() (logSnapshot, error)) (logSnapshot, error) {
+	var levels logSnapshot
+	defaultLevel, defaultSet := s.All, s.AllSet
+	if s.AllSet {
+		levels = append(levels, loggerLevel{Name: defaultLoggerName, Level: s.All})
+	}
+	for _, t := range s.Loggers {
+		level := t.Level
+		if t.Reset {
+			if !defaultSet {
+				snapshot, err := current()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read the default level to reset %v: %v", t.Name, err)
+				}
+				defaultLevel, defaultSet = snapshot.defaultLevel(), true
+			}
+			level = defaultLevel
+		}
+		levels = append(levels, loggerLevel{Name: t.Name, Level: level})
+	}
+	return levels, nil
+}
+
+// validateTermLogger validates the logger name unless loggers is nil
+func validateTermLogger(name string, loggers []string) error {
+	if loggers == nil {
+		return nil
+	}
+	return validateLogger(name, loggers)
+}
+
+func errorList(err error) []error {
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
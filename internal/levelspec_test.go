@@ -0,0 +1,229 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// specSnapshot parses and resolves a level spec without resets
+func specSnapshot(t *testing.T, logLevel string, loggers []string) logSnapshot {
+	t.Helper()
+	spec, err := parseLevelSpec(logLevel, loggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	levels, err := spec.resolve(nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return levels
+}
+
+// specLevels parses and resolves a level spec without resets, by logger
+func specLevels(t *testing.T, logLevel string, loggers []string) map[string]Level {
+	t.Helper()
+	return specSnapshot(t, logLevel, loggers).levels()
+}
+
+func TestParseLevelSpec_A001(t *testing.T) {
+	spec, err := parseLevelSpec("router:trace,http=debug,info,rbac:off", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := levelSpec{
+		All:    InfoLevel,
+		AllSet: true,
+		Loggers: []loggerTerm{
+			{Name: "router", Level: TraceLevel},
+			{Name: "http", Level: DebugLevel},
+			{Name: "rbac", Level: OffLevel},
+		},
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+}
+
+func TestParseLevelSpec_A002(t *testing.T) {
+	for _, logLevel := range []string{"*=debug", "*:debug", "level=debug", "debug"} {
+		spec, err := parseLevelSpec(logLevel, allLoggers)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !spec.AllSet || spec.All != DebugLevel || len(spec.Loggers) != 0 {
+			t.Errorf("Unexpected spec %+v for %v", spec, logLevel)
+		}
+	}
+}
+
+func TestParseLevelSpec_A003(t *testing.T) {
+	spec, err := parseLevelSpec("-http,router:debug", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []loggerTerm{{Name: "http", Reset: true}, {Name: "router", Level: DebugLevel}}
+	if !reflect.DeepEqual(spec.Loggers, expected) {
+		t.Errorf("Unexpected loggers %+v", spec.Loggers)
+	}
+
+	for _, logLevel := range []string{"-", "-*", "-hpp"} {
+		if _, err := parseLevelSpec(logLevel, allLoggers); err == nil {
+			t.Errorf("Invalid reset %v accepted", logLevel)
+		}
+	}
+}
+
+func TestParseLevelSpec_A004(t *testing.T) {
+	tests := []struct {
+		logLevel string
+		err      string
+	}{
+		{"http:debug,http:trace", "conflicting levels for logger http: debug and trace"},
+		{"http:debug,-http", "conflicting levels for logger http: debug and reset"},
+		{"info,*=debug", "conflicting levels for every logger: info and debug"},
+		{"debug,trace", "conflicting levels for every logger: debug and trace"},
+		{"http:loud", "unrecognized logging level: loud"},
+		{":debug", "missing logger name in :debug"},
+		{"info,,http:debug", "empty term in level spec"},
+	}
+	for _, test := range tests {
+		_, err := parseLevelSpec(test.logLevel, allLoggers)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Expected %q for %v, got %v", test.err, test.logLevel, err)
+		}
+	}
+
+	// Repeating a logger with the same level is no conflict
+	spec, err := parseLevelSpec("http:debug,http=debug", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(spec.Loggers) != 1 {
+		t.Errorf("Unexpected loggers %+v", spec.Loggers)
+	}
+}
+
+func TestParseLevelSpec_A005(t *testing.T) {
+	_, err := parseLevelSpec("htp:debug,router:loud,http:debug,http:trace", allLoggers)
+	if err == nil {
+		t.Fatal("Expected invalid terms to be rejected")
+	}
+	// Every failure is reported, not only the last one
+	failures := strings.Split(err.Error(), "\n")
+	if len(failures) != 3 {
+		t.Fatalf("Expected 3 failures, got %q", err.Error())
+	}
+	for i, failure := range []string{"htp", "loud", "conflicting levels for logger http"} {
+		if !strings.Contains(failures[i], failure) {
+			t.Errorf("Expected %q in %q", failure, failures[i])
+		}
+	}
+}
+
+func TestParseLevelSpec_A006(t *testing.T) {
+	writeTestProfiles(t, `
+profiles:
+  checkout:
+    router: trace
+    http: debug
+  payments:
+    http: trace
+`)
+
+	// Explicit loggers override the ones of profiles, wherever they are given
+	spec, err := parseLevelSpec("http:info,checkout", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []loggerTerm{{Name: "http", Level: InfoLevel}, {Name: "router", Level: TraceLevel, Profile: "checkout"}}
+	if !reflect.DeepEqual(spec.Loggers, expected) {
+		t.Errorf("Unexpected loggers %+v", spec.Loggers)
+	}
+
+	// Profiles don't override each other
+	_, err = parseLevelSpec("checkout,payments", allLoggers)
+	if err == nil || err.Error() != "conflicting levels for logger http: debug (profile checkout) and trace (profile payments)" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestResolveLevelSpec_A001(t *testing.T) {
+	spec, err := parseLevelSpec("router:trace,-http,info", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	current := func() (logSnapshot, error) {
+		t.Error("The proxy's default level read while the spec sets it")
+		return nil, nil
+	}
+	levels, err := spec.resolve(current)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := logSnapshot{{"level", InfoLevel}, {"router", TraceLevel}, {"http", InfoLevel}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Unexpected levels %v", levels)
+	}
+}
+
+func TestResolveLevelSpec_A002(t *testing.T) {
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spec, err := parseLevelSpec("-http,-admin", allLoggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The proxy's default level is read once for every reset
+	reads := 0
+	levels, err := spec.resolve(func() (logSnapshot, error) {
+		reads++
+		return snapshot, nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := logSnapshot{{"http", snapshot.commonLevel()}, {"admin", snapshot.commonLevel()}}
+	if reads != 1 || !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Unexpected levels %v after %d reads", levels, reads)
+	}
+
+	_, err = spec.resolve(func() (logSnapshot, error) { return nil, errors.New("connection refused") })
+	if err == nil || !strings.Contains(err.Error(), "reset http") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestResolveLevelSpec_A003(t *testing.T) {
+	snapshot, err := parseZtunnelSnapshot("current log level is access=debug,warn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spec, err := parseLevelSpec("-access", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	levels, err := spec.resolve(func() (logSnapshot, error) { return snapshot, nil })
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(levels, logSnapshot{{"access", WarningLevel}}) {
+		t.Errorf("Expected the ztunnel default level, got %v", levels)
+	}
+}
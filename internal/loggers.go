@@ -0,0 +1,183 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxSuggestionDistance = 2
+
+// proxyLoggers returns the logger names reported by the pod's proxy through
+// current, falling back to the static allLoggers list when the proxy can't be
+// reached. The proxy is only asked when the level spec names loggers or
+// profiles.
+func proxyLoggers(logLevel, pod string, current func() (logSnapshot, error)) []string {
+	if !namesLoggers(logLevel) {
+		return allLoggers
+	}
+
+	snapshot, err := current()
+	if err != nil {
+		log.Debugf("failed to discover loggers of %v, using the built-in list: %v", pod, err)
+		return allLoggers
+	}
+
+	loggers := make([]string, 0, len(snapshot))
+	for _, ll := range snapshot {
+		loggers = append(loggers, ll.Name)
+	}
+	return loggers
+}
+
+// namesLoggers tells whether the level spec has anything but levels
+func namesLoggers(logLevel string) bool {
+	for _, term := range strings.Split(logLevel, ",") {
+		if _, ok := stringToLevel[term]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Envoy built with fine-grain logging has a logger per source file rather than
+// per component. Its levels are set by path globs, such as
+// source/common/http/*, and its logging response lists source paths.
+
+// isPathGlob tells whether the name is a source path glob rather than a logger
+func isPathGlob(name string) bool {
+	return strings.ContainsAny(name, "/.*?")
+}
+
+// isFineGrain tells whether the loggers reported by a proxy are fine-grain
+func isFineGrain(loggers []string) bool {
+	for _, logger := range loggers {
+		if strings.Contains(logger, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLogger checks a logger name, or a path glob when the proxy uses
+// fine-grain logging
+func validateLogger(name string, loggers []string) error {
+	fineGrain := isFineGrain(loggers)
+	switch {
+	case isPathGlob(name) && !fineGrain:
+		return fmt.Errorf("%v is a source path glob but the proxy doesn't use fine-grain logging", name)
+	case isPathGlob(name):
+		return nil
+	case fineGrain:
+		return fmt.Errorf("%v is a logger name but the proxy uses fine-grain logging, set levels by source path with --paths", name)
+	}
+	return validateLoggerName(name, loggers)
+}
+
+// globMatch matches a source path against an Envoy path glob, where * matches
+// any sequence, slashes included, and ? any single character
+func globMatch(glob, path string) bool {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	matched, err := regexp.MatchString("^"+pattern+"$", path)
+	return err == nil && matched
+}
+
+// LevelWithPaths appends the --paths globs to the level spec, which is only
+// kept when set explicitly. Every term must be a source path glob:level pair.
+func LevelWithPaths(logLevel string, levelSet bool, paths string) (string, error) {
+	if paths == "" {
+		return logLevel, nil
+	}
+	for _, term := range strings.Split(paths, ",") {
+		glob, level, found := strings.Cut(term, ":")
+		if !found || !isPathGlob(glob) {
+			return "", fmt.Errorf("invalid path spec %v, expected <glob>:<level> such as source/common/http/*:debug", term)
+		}
+		if _, ok := stringToLevel[level]; !ok {
+			return "", fmt.Errorf("unrecognized logging level: %v", level)
+		}
+	}
+	if !levelSet {
+		return paths, nil
+	}
+	return logLevel + "," + paths, nil
+}
+
+// validateLoggerName checks the logger is known and otherwise suggests the
+// closest known names.
+func validateLoggerName(name string, loggers []string) error {
+	for _, logger := range loggers {
+		if logger == name {
+			return nil
+		}
+	}
+
+	suggestions := suggestLoggers(name, loggers)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("unrecognized logger name: %v", name)
+	}
+	return fmt.Errorf("unrecognized logger name: %v, did you mean %v?", name, strings.Join(suggestions, ", "))
+}
+
+// suggestLoggers returns the loggers within a small edit distance of name, or
+// sharing its prefix, closest first.
+func suggestLoggers(name string, loggers []string) []string {
+	distances := map[string]int{}
+	var suggestions []string
+	for _, logger := range loggers {
+		d := editDistance(name, logger)
+		if d > maxSuggestionDistance && (len(name) < 3 || !strings.HasPrefix(logger, name)) {
+			continue
+		}
+		distances[logger] = d
+		suggestions = append(suggestions, logger)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return distances[suggestions[i]] < distances[suggestions[j]]
+	})
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateLoggerName_A001(t *testing.T) {
+	if err := validateLoggerName("ext_authz", allLoggers); err != nil {
+		t.Errorf("Error while using legal loggerName: %v", err)
+	}
+}
+
+func TestValidateLoggerName_A002(t *testing.T) {
+	err := validateLoggerName("htp", []string{"admin", "http", "http2", "rbac"})
+	if err == nil {
+		t.Fatal("Error while using illegal loggerName")
+	}
+	if err.Error() != "unrecognized logger name: htp, did you mean http, http2?" {
+		t.Errorf("Unexpected error %q", err.Error())
+	}
+}
+
+func TestValidateLoggerName_A003(t *testing.T) {
+	err := validateLoggerName("hello", []string{"admin", "http", "rbac"})
+	if err == nil || err.Error() != "unrecognized logger name: hello" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestSuggestLoggers_A001(t *testing.T) {
+	suggestions := suggestLoggers("ext", []string{"ext_authz", "ext_proc", "router"})
+	if !reflect.DeepEqual(suggestions, []string{"ext_proc", "ext_authz"}) {
+		t.Errorf("Unexpected suggestions %v", suggestions)
+	}
+}
+
+func TestEditDistance_A001(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"http", "http", 0},
+		{"htp", "http", 1},
+		{"rbca", "rbac", 2},
+		{"", "admin", 5},
+	}
+	for _, test := range tests {
+		if d := editDistance(test.a, test.b); d != test.distance {
+			t.Errorf("Distance between %v and %v is %d, expected %d", test.a, test.b, d, test.distance)
+		}
+	}
+}
+
+func TestValidateLogger_A001(t *testing.T) {
+	fineGrain := []string{"source/common/http/conn_manager_impl.cc", "source/common/router/router.cc"}
+	if err := validateLogger("source/common/http/*", fineGrain); err != nil {
+		t.Errorf("Error while using a path glob in fine-grain mode: %v", err)
+	}
+	if err := validateLogger("http", fineGrain); err == nil {
+		t.Error("Logger name accepted in fine-grain mode")
+	}
+	if err := validateLogger("source/common/http/*", allLoggers); err == nil {
+		t.Error("Path glob accepted without fine-grain mode")
+	}
+	if err := validateLogger("http", allLoggers); err != nil {
+		t.Errorf("Error while using a logger name: %v", err)
+	}
+}
+
+func TestGlobMatch_A001(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		matched    bool
+	}{
+		{"source/common/http/*", "source/common/http/conn_manager_impl.cc", true},
+		{"source/common/http/*", "source/common/http/http1/codec_impl.cc", true},
+		{"source/common/http/*", "source/common/router/router.cc", false},
+		{"source/*/router.cc", "source/common/router/router.cc", true},
+		{"source/common/router/router.c?", "source/common/router/router.cc", true},
+		{"source/common/router/router.c", "source/common/router/router.cc", false},
+	}
+	for _, test := range tests {
+		if matched := globMatch(test.glob, test.path); matched != test.matched {
+			t.Errorf("Matching %v against %v returned %v", test.glob, test.path, matched)
+		}
+	}
+}
+
+func TestLevelWithPaths_A001(t *testing.T) {
+	tests := []struct {
+		level    string
+		levelSet bool
+		paths    string
+		expected string
+	}{
+		{"warning", false, "", "warning"},
+		{"warning", false, "source/common/http/*:debug", "source/common/http/*:debug"},
+		{"info", true, "source/common/http/*:debug,source/common/router/*:trace", "info,source/common/http/*:debug,source/common/router/*:trace"},
+	}
+	for _, test := range tests {
+		logLevel, err := LevelWithPaths(test.level, test.levelSet, test.paths)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if logLevel != test.expected {
+			t.Errorf("Expected %v, got %v", test.expected, logLevel)
+		}
+	}
+}
+
+func TestLevelWithPaths_A002(t *testing.T) {
+	for _, paths := range []string{"http:debug", "source/common/http/*", "source/common/http/*:loud"} {
+		if _, err := LevelWithPaths("warning", false, paths); err == nil {
+			t.Errorf("Invalid paths %v accepted", paths)
+		}
+	}
+}
@@ -15,12 +15,10 @@ limitations under the License.
 package internal
 
 import (
-	"errors"
 	"os"
-	"path/filepath"
 
+	"istio.io/istio/pkg/kube"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -29,40 +27,45 @@ type options struct {
 	namespace string
 }
 
-func GetOpts(context *rest.Config, ns string) (*options, error) {
-	cs, err := kubernetes.NewForConfig(context)
-	if err != nil {
-		return nil, err
+// GetClientConfig loads the kubeconfig the way kubectl does, from the given
+// path, KUBECONFIG or ~/.kube/config, and applies the overrides of the
+// standard kubectl flags such as --context, --cluster or --namespace. Like
+// kubectl, a given path must exist rather than fall back to the default
+// kubeconfig, which may select another cluster.
+func GetClientConfig(kubeconfig string, overrides *clientcmd.ConfigOverrides) (clientcmd.ClientConfig, error) {
+	if kubeconfig != "" {
+		if _, err := os.Stat(kubeconfig); err != nil {
+			return nil, err
+		}
 	}
-
-	return &options{
-		clientset: cs,
-		namespace: ns,
-	}, nil
+	return kube.BuildClientCmd(kubeconfig, "", func(o *clientcmd.ConfigOverrides) {
+		defaults := o.ClusterDefaults
+		*o = *overrides
+		o.ClusterDefaults = defaults
+	}), nil
 }
 
-func GetContext() (*rest.Config, error) {
-	path, err := configPath()
+// GetOpts builds the Kubernetes client from the client config, which is also
+// used for the Istio client, so both talk to the same cluster. The namespace
+// defaults to the one of the current context.
+func GetOpts(config clientcmd.ClientConfig) (*options, error) {
+	restConfig, err := config.ClientConfig()
 	if err != nil {
 		return nil, err
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", path)
+	ns, _, err := config.Namespace()
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
-}
 
-func configPath() (string, error) {
-	if home := homeDir(); home != "" {
-		return filepath.Join(home, ".kube", "config"), nil
+	cs, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
 	}
-	return "", errors.New("HOME OR USERPROFILE env variables are not set")
-}
+	clientConfig = config
 
-func homeDir() string {
-	if home := os.Getenv("HOME"); home != "" {
-		return home
-	}
-	return os.Getenv("USERPROFILE")
+	return &options{
+		clientset: cs,
+		namespace: ns,
+	}, nil
 }
@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+- name: production
+  cluster:
+    server: https://production.example.com
+users:
+- name: dev
+  user:
+    token: unit-test-token
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: dev
+    namespace: bookinfo
+- name: production
+  context:
+    cluster: production
+    user: dev
+current-context: staging
+`
+
+func writeTestKubeConfig(t *testing.T) string {
+	// GetOpts points the Istio client to the kubeconfig under test
+	previous := clientConfig
+	t.Cleanup(func() { clientConfig = previous })
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeConfig), 0o600); err != nil {
+		t.Fatal(err.Error())
+	}
+	return path
+}
+
+func TestGetOpts_A001(t *testing.T) {
+	config, err := GetClientConfig(writeTestKubeConfig(t), &clientcmd.ConfigOverrides{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	options, err := GetOpts(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if options.namespace != "bookinfo" {
+		t.Errorf("Expected the namespace of the current context, got %v", options.namespace)
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if restConfig.Host != "https://staging.example.com" {
+		t.Errorf("Istio client targets %v instead of the current context", restConfig.Host)
+	}
+}
+
+func TestGetOpts_A002(t *testing.T) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: "production"}
+	overrides.Context.Namespace = "reviews"
+
+	config, err := GetClientConfig(writeTestKubeConfig(t), overrides)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	options, err := GetOpts(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if options.namespace != "reviews" {
+		t.Errorf("Expected the namespace override, got %v", options.namespace)
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if restConfig.Host != "https://production.example.com" {
+		t.Errorf("Istio client targets %v instead of the --context override", restConfig.Host)
+	}
+}
+
+func TestGetOpts_A003(t *testing.T) {
+	t.Setenv("KUBECONFIG", writeTestKubeConfig(t))
+
+	config, err := GetClientConfig("", &clientcmd.ConfigOverrides{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	options, err := GetOpts(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if options.namespace != "bookinfo" {
+		t.Errorf("Expected the namespace of the KUBECONFIG current context, got %v", options.namespace)
+	}
+}
+
+func TestGetClientConfig_A001(t *testing.T) {
+	// A default kubeconfig that a missing --kubeconfig must not fall back to
+	t.Setenv("KUBECONFIG", writeTestKubeConfig(t))
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := GetClientConfig(missing, &clientcmd.ConfigOverrides{}); err == nil || !os.IsNotExist(err) {
+		t.Errorf("Expected a missing kubeconfig to be rejected, got %v", err)
+	}
+}
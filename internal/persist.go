@@ -0,0 +1,263 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The sidecar injector turns these pod annotations into the proxy's
+// --proxyLogLevel and --proxyComponentLogLevel, so levels set on the pod
+// template survive restarts.
+const (
+	logLevelAnnotation          = "sidecar.istio.io/logLevel"
+	componentLogLevelAnnotation = "sidecar.istio.io/componentLogLevel"
+)
+
+var persistAnnotations = []string{logLevelAnnotation, componentLogLevelAnnotation}
+
+// templateChange is a change to the log level annotations of the pod
+// template of a workload. A missing annotation in After is removed.
+type templateChange struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Before    map[string]string
+	After     map[string]string
+}
+
+// KubectlIstioLogPersist sets the levels as annotations on the pod templates
+// of the workloads owning the targeted pods, or removes them with unpersist.
+// As it rolls the workloads out, the changes are shown and confirmed first
+// unless yes is set.
+func (opts *options) KubectlIstioLogPersist(target Target, logLevel string, unpersist, yes bool, in io.Reader, out io.Writer) error {
+	pods, err := opts.getPods(target)
+	if err != nil {
+		return err
+	}
+
+	after := map[string]string{}
+	if !unpersist {
+		spec, err := parseLevelSpec(logLevel, proxyLoggers(logLevel, pods[0].Name, lazySnapshot(pods[0].Name, pods[0].Namespace)))
+		if err != nil {
+			return err
+		}
+		for _, t := range spec.Loggers {
+			if t.Reset {
+				return fmt.Errorf("can't persist the reset of %v, leave it out of the level spec instead", t.Name)
+			}
+			if isPathGlob(t.Name) {
+				return fmt.Errorf("can't persist path glob %v, the sidecar annotations only take logger names", t.Name)
+			}
+		}
+		// Without resets, the proxy's default level is never read
+		levels, err := spec.resolve(nil)
+		if err != nil {
+			return err
+		}
+		after = levelAnnotations(levels.levels())
+	}
+
+	changes, err := opts.templateChanges(pods, after)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "The pod templates already have the requested log levels")
+		return nil
+	}
+
+	printTemplateChanges(out, changes)
+	if !yes && !confirm(in, out, fmt.Sprintf("This rolls out %d workload(s). Continue?", len(changes))) {
+		return fmt.Errorf("aborted")
+	}
+
+	for _, change := range changes {
+		if err := opts.patchTemplate(change); err != nil {
+			return fmt.Errorf("failed to patch %v/%v: %v", change.Kind, change.Name, err)
+		}
+		fmt.Fprintf(out, "%v/%v patched\n", change.Kind, change.Name)
+	}
+	return nil
+}
+
+// levelAnnotations renders the levels as the injector annotations
+func levelAnnotations(levels map[string]Level) map[string]string {
+	annotations := map[string]string{}
+	var components []string
+	for lg, ll := range levels {
+		if lg == defaultLoggerName {
+			annotations[logLevelAnnotation] = ll.String()
+		} else {
+			components = append(components, lg+":"+ll.String())
+		}
+	}
+	if len(components) > 0 {
+		sort.Strings(components)
+		annotations[componentLogLevelAnnotation] = strings.Join(components, ",")
+	}
+	return annotations
+}
+
+// templateChanges returns the changes to the workloads owning the pods,
+// leaving out the ones already annotated as requested.
+func (opts *options) templateChanges(pods []corev1.Pod, after map[string]string) ([]templateChange, error) {
+	var changes []templateChange
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		kind, name, err := opts.podWorkload(pod)
+		if err != nil {
+			return nil, err
+		}
+		key := pod.Namespace + "/" + kind + "/" + name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		template, err := opts.getTemplate(kind, name, pod.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		before := map[string]string{}
+		for _, annotation := range persistAnnotations {
+			if value, ok := template.Annotations[annotation]; ok {
+				before[annotation] = value
+			}
+		}
+
+		change := templateChange{Kind: kind, Name: name, Namespace: pod.Namespace, Before: before, After: after}
+		if !change.empty() {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (c templateChange) empty() bool {
+	for _, annotation := range persistAnnotations {
+		if c.Before[annotation] != c.After[annotation] {
+			return false
+		}
+	}
+	return true
+}
+
+// podWorkload returns the deployment or statefulset owning the pod
+func (opts *options) podWorkload(pod corev1.Pod) (string, string, error) {
+	for _, ref := range pod.OwnerReferences {
+		switch ref.Kind {
+		case "StatefulSet":
+			return "statefulset", ref.Name, nil
+		case "ReplicaSet":
+			rs, err := opts.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", "", err
+			}
+			for _, rsRef := range rs.OwnerReferences {
+				if rsRef.Kind == "Deployment" {
+					return "deployment", rsRef.Name, nil
+				}
+			}
+		}
+	}
+	return "", "", fmt.Errorf("%v isn't owned by a deployment or statefulset", pod.Name)
+}
+
+func (opts *options) getTemplate(kind, name, namespace string) (*corev1.PodTemplateSpec, error) {
+	if kind == "statefulset" {
+		sts, err := opts.clientset.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &sts.Spec.Template, nil
+	}
+	deploy, err := opts.clientset.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &deploy.Spec.Template, nil
+}
+
+func (opts *options) patchTemplate(change templateChange) error {
+	annotations := map[string]interface{}{}
+	for _, annotation := range persistAnnotations {
+		if value, ok := change.After[annotation]; ok {
+			annotations[annotation] = value
+		} else {
+			annotations[annotation] = nil
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": annotations,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if change.Kind == "statefulset" {
+		_, err = opts.clientset.AppsV1().StatefulSets(change.Namespace).Patch(context.TODO(), change.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	} else {
+		_, err = opts.clientset.AppsV1().Deployments(change.Namespace).Patch(context.TODO(), change.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	return err
+}
+
+// printTemplateChanges prints the changed annotations of every workload
+func printTemplateChanges(out io.Writer, changes []templateChange) {
+	for _, change := range changes {
+		fmt.Fprintf(out, "%v/%v (%v):\n", change.Kind, change.Name, change.Namespace)
+		for _, annotation := range persistAnnotations {
+			before, after := change.Before[annotation], change.After[annotation]
+			if before == after {
+				continue
+			}
+			if before == "" {
+				before = "<none>"
+			}
+			if after == "" {
+				after = "<none>"
+			}
+			fmt.Fprintf(out, "  %v: %v -> %v\n", annotation, before, after)
+		}
+	}
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%v [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPersistTestOptions(t *testing.T) options {
+	pod := newTestPod("reviews-1", map[string]string{"app": "reviews"}, "app", istioContainer)
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "reviews-abc", UID: "rs-uid"}}
+	options := newTestOptions(t, pod)
+
+	cs := options.clientset
+	_, err := cs.AppsV1().Deployments(options.namespace).Create(context.TODO(), &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "reviews", UID: "deploy-uid"},
+		Spec: appsv1.DeploymentSpec{Template: appv1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				componentLogLevelAnnotation: "misc:error",
+				"prometheus.io/scrape":      "true",
+			},
+		}}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = cs.AppsV1().ReplicaSets(options.namespace).Create(context.TODO(), &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "reviews-abc",
+			UID:             "rs-uid",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "reviews", UID: "deploy-uid"}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return options
+}
+
+func templateAnnotations(t *testing.T, options options) map[string]string {
+	deploy, err := options.clientset.AppsV1().Deployments(options.namespace).Get(context.TODO(), "reviews", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return deploy.Spec.Template.Annotations
+}
+
+func TestKubectlIstioLogPersist_A001(t *testing.T) {
+	options := newPersistTestOptions(t)
+
+	var out bytes.Buffer
+	err := options.KubectlIstioLogPersist(Target{Pod: "reviews-1"}, "debug", false, false, strings.NewReader("n\n"), &out)
+	if err == nil {
+		t.Error("Expected the change to be aborted")
+	}
+	for _, line := range []string{
+		"deployment/reviews (unit-test-namespace):",
+		"  sidecar.istio.io/logLevel: <none> -> debug",
+		"  sidecar.istio.io/componentLogLevel: misc:error -> <none>",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected %q in the diff, got %q", line, out.String())
+		}
+	}
+	if _, ok := templateAnnotations(t, options)[logLevelAnnotation]; ok {
+		t.Error("Expected the template to be left unchanged")
+	}
+
+	out.Reset()
+	err = options.KubectlIstioLogPersist(Target{Pod: "reviews-1"}, "debug", false, false, strings.NewReader("y\n"), &out)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	annotations := templateAnnotations(t, options)
+	if annotations[logLevelAnnotation] != "debug" || annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("Unexpected annotations %v", annotations)
+	}
+	if _, ok := annotations[componentLogLevelAnnotation]; ok {
+		t.Errorf("Expected %v to be removed, got %v", componentLogLevelAnnotation, annotations)
+	}
+}
+
+func TestKubectlIstioLogPersist_A002(t *testing.T) {
+	options := newPersistTestOptions(t)
+
+	var out bytes.Buffer
+	err := options.KubectlIstioLogPersist(Target{Pod: "deploy/reviews"}, "", true, true, nil, &out)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	annotations := templateAnnotations(t, options)
+	if len(annotations) != 1 || annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("Expected only the log level annotations to be removed, got %v", annotations)
+	}
+
+	// Nothing left to remove
+	out.Reset()
+	err = options.KubectlIstioLogPersist(Target{Pod: "reviews-1"}, "", true, false, nil, &out)
+	if err != nil || !strings.Contains(out.String(), "already") {
+		t.Errorf("Expected no change, got %q err=%v", out.String(), err)
+	}
+}
+
+func TestLevelAnnotations_A001(t *testing.T) {
+	annotations := levelAnnotations(map[string]Level{
+		defaultLoggerName: InfoLevel,
+		"router":          DebugLevel,
+		"http":            TraceLevel,
+	})
+	if annotations[logLevelAnnotation] != "info" || annotations[componentLogLevelAnnotation] != "http:trace,router:debug" {
+		t.Errorf("Unexpected annotations %v", annotations)
+	}
+}
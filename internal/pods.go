@@ -0,0 +1,274 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Target selects the pods whose istio-proxy containers are acted upon.
+// Exactly one of Pod, Selector or All is expected to be set. Pod is either a
+// pod name or a workload reference such as deploy/reviews or svc/productpage.
+// Pods in ambient mode are handled by their node's ztunnel, or by their
+// waypoint when Waypoint is set.
+type Target struct {
+	Pod      string
+	Selector string
+	All      bool
+	Waypoint bool
+}
+
+func (t Target) validate() error {
+	set := 0
+	if t.Pod != "" {
+		set++
+	}
+	if t.Selector != "" {
+		set++
+	}
+	if t.All {
+		set++
+	}
+	switch set {
+	case 0:
+		return errors.New("a pod name, --selector or --all is required")
+	case 1:
+		return nil
+	default:
+		return errors.New("a pod name, --selector and --all are mutually exclusive")
+	}
+}
+
+// workload kinds accepted as kind/name, keyed by every alias kubectl accepts
+var workloadKinds = map[string]string{
+	"po":           "pod",
+	"pod":          "pod",
+	"pods":         "pod",
+	"deploy":       "deployment",
+	"deployment":   "deployment",
+	"deployments":  "deployment",
+	"sts":          "statefulset",
+	"statefulset":  "statefulset",
+	"statefulsets": "statefulset",
+	"ds":           "daemonset",
+	"daemonset":    "daemonset",
+	"daemonsets":   "daemonset",
+	"svc":          "service",
+	"service":      "service",
+	"services":     "service",
+}
+
+// parseWorkloadRef splits a kind/name reference. A plain name refers to a pod.
+func parseWorkloadRef(ref string) (string, string, error) {
+	kindName := strings.SplitN(ref, "/", 2)
+	if len(kindName) == 1 {
+		return "pod", ref, nil
+	}
+
+	kind, ok := workloadKinds[strings.ToLower(kindName[0])]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported resource type: %v", kindName[0])
+	}
+	if kindName[1] == "" {
+		return "", "", fmt.Errorf("resource name may not be empty: %v", ref)
+	}
+	return kind, kindName[1], nil
+}
+
+// getPods resolves the target to the list of proxy pods to operate on. A pod
+// given by name is returned as is, pods matched by a workload, a selector or
+// --all are limited to the ones running an istio-proxy container or in
+// ambient mode, the latter being replaced by their ztunnel or waypoint.
+func (opts *options) getPods(target Target) ([]corev1.Pod, error) {
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+	pods, err := opts.targetPods(target)
+	if err != nil {
+		return nil, err
+	}
+	return opts.ambientProxies(pods, target.Waypoint)
+}
+
+func (opts *options) targetPods(target Target) ([]corev1.Pod, error) {
+	if target.Pod != "" {
+		kind, name, err := parseWorkloadRef(target.Pod)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "pod" {
+			pod, err := opts.getPod(name)
+			if err != nil {
+				return nil, err
+			}
+			return []corev1.Pod{*pod}, nil
+		}
+		return opts.getWorkloadPods(kind, name)
+	}
+
+	result, err := opts.clientset.CoreV1().Pods(opts.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: target.Selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range result.Items {
+		if hasIstioProxy(pod) || isAmbient(pod) {
+			pods = append(pods, pod)
+		}
+	}
+
+	if len(pods) == 0 {
+		if target.Selector != "" {
+			return nil, fmt.Errorf("no pods with an %v container or in ambient mode match selector %q in namespace %v", istioContainer, target.Selector, opts.namespace)
+		}
+		return nil, fmt.Errorf("no pods with an %v container or in ambient mode found in namespace %v", istioContainer, opts.namespace)
+	}
+
+	return pods, nil
+}
+
+func hasIstioProxy(pod corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == istioContainer {
+			return true
+		}
+	}
+	// Native sidecars are declared as init containers
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == istioContainer {
+			return true
+		}
+	}
+	return false
+}
+
+// getWorkloadPods resolves a deployment, statefulset, daemonset or service to
+// its current pods. Pods of controllers are matched through the selector and
+// then checked against their owner references, so pods of another workload
+// sharing the same labels are left out.
+func (opts *options) getWorkloadPods(kind, name string) ([]corev1.Pod, error) {
+	var selector labels.Selector
+	var owners map[types.UID]bool
+	var err error
+
+	switch kind {
+	case "deployment":
+		selector, owners, err = opts.deploymentOwners(name)
+	case "statefulset":
+		var sts *appsv1.StatefulSet
+		sts, err = opts.clientset.AppsV1().StatefulSets(opts.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			selector, err = metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+			owners = map[types.UID]bool{sts.UID: true}
+		}
+	case "daemonset":
+		var ds *appsv1.DaemonSet
+		ds, err = opts.clientset.AppsV1().DaemonSets(opts.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			selector, err = metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+			owners = map[types.UID]bool{ds.UID: true}
+		}
+	case "service":
+		var svc *corev1.Service
+		svc, err = opts.clientset.CoreV1().Services(opts.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			if len(svc.Spec.Selector) == 0 {
+				return nil, fmt.Errorf("%v/%v has no selector", kind, name)
+			}
+			selector = labels.SelectorFromSet(svc.Spec.Selector)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %v", kind)
+	}
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%v/%v doesn't exist", kind, name)
+		}
+		return nil, err
+	}
+
+	result, err := opts.clientset.CoreV1().Pods(opts.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range result.Items {
+		if pod.DeletionTimestamp != nil || (!hasIstioProxy(pod) && !isAmbient(pod)) {
+			continue
+		}
+		if owners != nil && !isOwnedBy(&pod, owners) {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods with an %v container or in ambient mode found for %v/%v", istioContainer, kind, name)
+	}
+	return pods, nil
+}
+
+// deploymentOwners returns the selector of a deployment along with the UIDs
+// of the replicasets it owns, which in turn own its pods.
+func (opts *options) deploymentOwners(name string) (labels.Selector, map[types.UID]bool, error) {
+	deploy, err := opts.clientset.AppsV1().Deployments(opts.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replicaSets, err := opts.clientset.AppsV1().ReplicaSets(opts.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners := map[types.UID]bool{}
+	for _, rs := range replicaSets.Items {
+		if isOwnedBy(&rs, map[types.UID]bool{deploy.UID: true}) {
+			owners[rs.UID] = true
+		}
+	}
+	return selector, owners, nil
+}
+
+func isOwnedBy(obj metav1.Object, owners map[types.UID]bool) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if owners[ref.UID] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPod(name string, labels map[string]string, containers ...string) *appv1.Pod {
+	pod := &appv1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "unit-test-namespace",
+		Labels:    labels,
+	}}
+	for _, c := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, appv1.Container{Name: c})
+	}
+	return pod
+}
+
+func newTestOptions(t *testing.T, pods ...*appv1.Pod) options {
+	cs := testclient.NewSimpleClientset()
+	options := options{
+		clientset: cs,
+		namespace: "unit-test-namespace",
+	}
+	for _, pod := range pods {
+		_, err := cs.CoreV1().Pods(options.namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return options
+}
+
+func TestGetPods_A001(t *testing.T) {
+	options := newTestOptions(t,
+		newTestPod("checkout-1", map[string]string{"app": "checkout"}, "app", istioContainer),
+		newTestPod("checkout-2", map[string]string{"app": "checkout"}, "app", istioContainer),
+		newTestPod("checkout-3", map[string]string{"app": "checkout"}, "app"),
+		newTestPod("cart-1", map[string]string{"app": "cart"}, "app", istioContainer),
+	)
+
+	pods, err := options.getPods(Target{Selector: "app=checkout"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 2 {
+		t.Errorf("Expected 2 pods with an istio-proxy container, got %d", len(pods))
+	}
+}
+
+func TestGetPods_A002(t *testing.T) {
+	options := newTestOptions(t,
+		newTestPod("checkout-1", map[string]string{"app": "checkout"}, "app", istioContainer),
+		newTestPod("cart-1", map[string]string{"app": "cart"}, "app", istioContainer),
+		newTestPod("job-1", nil, "app"),
+	)
+
+	pods, err := options.getPods(Target{All: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 2 {
+		t.Errorf("Expected 2 pods with an istio-proxy container, got %d", len(pods))
+	}
+}
+
+func TestGetPods_A003(t *testing.T) {
+	options := newTestOptions(t,
+		newTestPod("checkout-1", map[string]string{"app": "checkout"}, "app"),
+	)
+
+	_, err := options.getPods(Target{Selector: "app=checkout"})
+	if err == nil {
+		t.Errorf("Error while matching pods without an istio-proxy container")
+	}
+}
+
+func TestGetPods_A004(t *testing.T) {
+	options := newTestOptions(t)
+
+	if _, err := options.getPods(Target{}); err == nil {
+		t.Errorf("Error while using an empty target")
+	}
+	if _, err := options.getPods(Target{Pod: "checkout-1", All: true}); err == nil {
+		t.Errorf("Error while using a pod name together with --all")
+	}
+}
+
+func ownedBy(pod *appv1.Pod, uid types.UID) *appv1.Pod {
+	pod.OwnerReferences = []metav1.OwnerReference{{UID: uid}}
+	return pod
+}
+
+func TestParseWorkloadRef_A001(t *testing.T) {
+	tests := map[string][2]string{
+		"reviews-v1-abc":     {"pod", "reviews-v1-abc"},
+		"pod/reviews":        {"pod", "reviews"},
+		"deploy/reviews":     {"deployment", "reviews"},
+		"statefulset/db":     {"statefulset", "db"},
+		"ds/x":               {"daemonset", "x"},
+		"svc/productpage":    {"service", "productpage"},
+		"Deployment/ratings": {"deployment", "ratings"},
+	}
+	for ref, want := range tests {
+		kind, name, err := parseWorkloadRef(ref)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if kind != want[0] || name != want[1] {
+			t.Errorf("%v resolved to %v/%v, expected %v/%v", ref, kind, name, want[0], want[1])
+		}
+	}
+
+	for _, ref := range []string{"cronjob/x", "deploy/"} {
+		if _, _, err := parseWorkloadRef(ref); err == nil {
+			t.Errorf("Error while using illegal workload reference %v", ref)
+		}
+	}
+}
+
+func TestGetWorkloadPods_A001(t *testing.T) {
+	selector := map[string]string{"app": "reviews"}
+	options := newTestOptions(t,
+		ownedBy(newTestPod("reviews-abc-1", selector, "app", istioContainer), "rs-current"),
+		ownedBy(newTestPod("reviews-abc-2", selector, "app", istioContainer), "rs-current"),
+		ownedBy(newTestPod("reviews-canary-1", selector, "app", istioContainer), "rs-other"),
+	)
+
+	cs := options.clientset
+	_, err := cs.AppsV1().Deployments(options.namespace).Create(context.TODO(), &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "reviews", UID: "deploy-reviews"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: selector}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = cs.AppsV1().ReplicaSets(options.namespace).Create(context.TODO(), &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "reviews-abc",
+			UID:             "rs-current",
+			Labels:          selector,
+			OwnerReferences: []metav1.OwnerReference{{UID: "deploy-reviews"}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pods, err := options.getPods(Target{Pod: "deploy/reviews"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 2 {
+		t.Errorf("Expected 2 pods owned by deploy/reviews, got %d", len(pods))
+	}
+}
+
+func TestGetWorkloadPods_A002(t *testing.T) {
+	options := newTestOptions(t,
+		newTestPod("productpage-1", map[string]string{"app": "productpage"}, "app", istioContainer),
+		newTestPod("reviews-1", map[string]string{"app": "reviews"}, "app", istioContainer),
+	)
+
+	_, err := options.clientset.CoreV1().Services(options.namespace).Create(context.TODO(), &appv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "productpage"},
+		Spec:       appv1.ServiceSpec{Selector: map[string]string{"app": "productpage"}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pods, err := options.getPods(Target{Pod: "svc/productpage"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 1 || pods[0].Name != "productpage-1" {
+		t.Errorf("Expected svc/productpage to resolve to productpage-1, got %v", pods)
+	}
+}
+
+func TestGetWorkloadPods_A003(t *testing.T) {
+	options := newTestOptions(t)
+
+	_, err := options.getPods(Target{Pod: "sts/db"})
+	if err == nil {
+		t.Errorf("Error during reterving workload that doesn't exist")
+	}
+}
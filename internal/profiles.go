@@ -0,0 +1,177 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// logProfile is a named bundle of per-logger levels, usable in place of a
+// level in the level spec
+type logProfile map[string]Level
+
+// builtinProfiles are the levels commonly needed to troubleshoot a given
+// area of the mesh
+var builtinProfiles = map[string]logProfile{
+	"mtls": {
+		"connection": DebugLevel,
+		"secret":     DebugLevel,
+		"rbac":       DebugLevel,
+	},
+	"routing": {
+		"http":   DebugLevel,
+		"router": DebugLevel,
+		"rds":    DebugLevel,
+	},
+	"authz": {
+		"rbac":      DebugLevel,
+		"ext_authz": DebugLevel,
+		"jwt":       DebugLevel,
+	},
+	"healthcheck": {
+		"hc":             DebugLevel,
+		"health_checker": DebugLevel,
+		"upstream":       DebugLevel,
+	},
+	"wasm": {
+		"wasm": DebugLevel,
+	},
+	"lb": {
+		"upstream": DebugLevel,
+		"pool":     DebugLevel,
+	},
+}
+
+// profilesConfig is the format of the user-defined profiles file:
+//
+//	profiles:
+//	  checkout:
+//	    http: debug
+//	    router: trace
+type profilesConfig struct {
+	Profiles map[string]logProfile `json:"profiles"`
+}
+
+// profilesPath is the file of the user-defined profiles, under
+// $XDG_CONFIG_HOME or ~/.config
+func profilesPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kubectl-istiolog", "profiles.yaml"), nil
+}
+
+// loadProfiles returns the user-defined profiles, if any
+func loadProfiles() (map[string]logProfile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config profilesConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to load profiles from %v: %v", path, err)
+	}
+	for name := range config.Profiles {
+		if _, ok := stringToLevel[name]; ok || strings.ContainsAny(name, ":=,") {
+			return nil, fmt.Errorf("invalid profile name in %v: %v", path, name)
+		}
+	}
+	return config.Profiles, nil
+}
+
+// getProfile looks the profile up among the user-defined profiles, which
+// take precedence, and the built-in ones.
+func getProfile(name string) (logProfile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	if profile, ok := profiles[name]; ok {
+		return profile, nil
+	}
+	if profile, ok := builtinProfiles[name]; ok {
+		return profile, nil
+	}
+	return nil, fmt.Errorf("unrecognized logging level or profile: %v", name)
+}
+
+// String renders the profile as a level spec, sorted by logger name
+func (p logProfile) String() string {
+	loggers := make([]string, 0, len(p))
+	for logger := range p {
+		loggers = append(loggers, logger)
+	}
+	sort.Strings(loggers)
+	for i, logger := range loggers {
+		loggers[i] = logger + ":" + p[logger].String()
+	}
+	return strings.Join(loggers, ",")
+}
+
+// KubectlIstioLogProfiles prints the built-in and user-defined profiles
+func KubectlIstioLogProfiles() error {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	printProfiles(os.Stdout, profiles)
+	return nil
+}
+
+func printProfiles(out io.Writer, profiles map[string]logProfile) {
+	sources := map[string]string{}
+	all := map[string]logProfile{}
+	for name, profile := range builtinProfiles {
+		sources[name] = "built-in"
+		all[name] = profile
+	}
+	for name, profile := range profiles {
+		sources[name] = "user"
+		all[name] = profile
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tLEVELS")
+	for _, name := range names {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", name, sources[name], all[name])
+	}
+	w.Flush()
+}
@@ -0,0 +1,108 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestProfiles(t *testing.T, content string) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if content == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "kubectl-istiolog"), 0o755); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kubectl-istiolog", "profiles.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestParseLogLevelProfile_A001(t *testing.T) {
+	writeTestProfiles(t, "")
+
+	levels := specLevels(t, "info,mtls,rbac:trace", allLoggers)
+	expected := map[string]Level{
+		defaultLoggerName: InfoLevel,
+		"connection":      DebugLevel,
+		"secret":          DebugLevel,
+		"rbac":            TraceLevel,
+	}
+	if len(levels) != len(expected) {
+		t.Fatalf("Unexpected levels %v", levels)
+	}
+	for lg, ll := range expected {
+		if levels[lg] != ll {
+			t.Errorf("Expected %v for %v, got %v", ll, lg, levels[lg])
+		}
+	}
+
+	if _, err := parseLevelSpec("mtlz", nil); err == nil || !strings.Contains(err.Error(), "mtlz") {
+		t.Errorf("Expected an unrecognized profile error, got %v", err)
+	}
+}
+
+func TestParseLogLevelProfile_A002(t *testing.T) {
+	writeTestProfiles(t, `
+profiles:
+  checkout:
+    http: debug
+    router: trace
+  wasm:
+    wasm: trace
+`)
+
+	levels := specLevels(t, "checkout,wasm", allLoggers)
+	if len(levels) != 3 || levels["http"] != DebugLevel || levels["router"] != TraceLevel || levels["wasm"] != TraceLevel {
+		t.Errorf("Unexpected levels %v", levels)
+	}
+
+	// Profile loggers are validated like any other
+	writeTestProfiles(t, "profiles:\n  broken:\n    routr: debug\n")
+	if _, err := parseLevelSpec("broken", allLoggers); err == nil || !strings.Contains(err.Error(), "did you mean router") {
+		t.Errorf("Expected a suggestion, got %v", err)
+	}
+}
+
+func TestLoadProfiles_A001(t *testing.T) {
+	writeTestProfiles(t, "profiles:\n  debug:\n    http: debug\n")
+	if _, err := loadProfiles(); err == nil {
+		t.Error("Expected a profile named after a level to be rejected")
+	}
+
+	writeTestProfiles(t, "profiles:\n  checkout:\n    http: loud\n")
+	if _, err := loadProfiles(); err == nil {
+		t.Error("Expected an invalid level to be rejected")
+	}
+}
+
+func TestPrintProfiles_A001(t *testing.T) {
+	var out bytes.Buffer
+	printProfiles(&out, map[string]logProfile{
+		"checkout": {"router": TraceLevel, "http": DebugLevel},
+	})
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != len(builtinProfiles)+3 {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+	if strings.Join(strings.Fields(lines[2]), " ") != "checkout user http:debug,router:trace" {
+		t.Errorf("Unexpected line %q", lines[2])
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Levels are changed through the admin API of the pod's proxy: Envoy for
+// sidecars and waypoints, ztunnel in ambient mode and ControlZ for istiod.
+// Their levels are all kept as a logSnapshot.
+
+// maxConcurrentPods bounds the pods whose proxies are talked to at once
+const maxConcurrentPods = 10
+
+// forEachPod calls f for every pod, on at most maxConcurrentPods at once,
+// and returns once all calls returned
+func forEachPod(pods []corev1.Pod, f func(i int, pod corev1.Pod)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPods)
+	for i, pod := range pods {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pod corev1.Pod) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i, pod)
+		}(i, pod)
+	}
+	wg.Wait()
+}
+
+// podSnapshot reads the current levels of the proxy of the pod
+func podSnapshot(pod corev1.Pod) (logSnapshot, error) {
+	switch {
+	case isZtunnel(pod):
+		return getZtunnelSnapshot(pod.Name, pod.Namespace)
+	case isIstiod(pod):
+		return getIstiodSnapshot(pod.Name, pod.Namespace)
+	default:
+		return getLogSnapshot(pod.Name, pod.Namespace)
+	}
+}
+
+// setPodLogLevel applies the level spec to the proxy of the pod
+func setPodLogLevel(logLevel string, pod corev1.Pod) (string, error) {
+	switch {
+	case isZtunnel(pod):
+		return setZtunnelLogLevel(logLevel, pod.Name, pod.Namespace)
+	case isIstiod(pod):
+		return setIstiodLogLevel(logLevel, pod.Name, pod.Namespace)
+	}
+	return setEnvoyLogLevel(logLevel, pod.Name, pod.Namespace)
+}
+
+// handlePodLog applies the level spec to the proxy of the pod and prints
+// the resulting levels
+func handlePodLog(logLevel string, pod corev1.Pod) error {
+	if !isZtunnel(pod) && !isIstiod(pod) {
+		return handleLog(logLevel, pod.Name, pod.Namespace)
+	}
+	resp, err := setPodLogLevel(logLevel, pod)
+	if err != nil {
+		return err
+	}
+	fmt.Print(resp)
+	return nil
+}
+
+// restorePod sets the proxy of the pod back to the snapshot
+func (s logSnapshot) restorePod(pod corev1.Pod) error {
+	switch {
+	case isZtunnel(pod):
+		return s.restoreZtunnel(pod.Name, pod.Namespace)
+	case isIstiod(pod):
+		return s.restoreIstiod(pod.Name, pod.Namespace)
+	default:
+		return s.restore(pod.Name, pod.Namespace)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// logRecord is a log line of the istio-proxy container split into its fields.
+// Access log entries keep the whole line as message along with the parsed
+// entry. Lines that don't follow a known format only have Message set.
+type logRecord struct {
+	Pod        string `json:"pod,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Time       string `json:"time,omitempty"`
+	Level      string `json:"level,omitempty"`
+	Logger     string `json:"logger,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Thread     string `json:"thread,omitempty"`
+	Connection string `json:"connection,omitempty"`
+	Stream     string `json:"stream,omitempty"`
+	Message    string `json:"message"`
+
+	AccessLog *accessLogEntry `json:"access_log,omitempty"`
+}
+
+var (
+	// Istio configures Envoy with the log format
+	// %Y-%m-%dT%T.%fZ\t%l\tenvoy %n %g:%#\t%v\tthread=%t
+	// while pilot-agent logs as <time>\t<level>\t<scope>\t<message>
+	istioLogLine = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT[\d:.]+Z)\t(\w+)\t(.*)$`)
+	// Envoy's default format [%Y-%m-%d %T.%e][%t][%l][%n] [%g:%#] %v
+	envoyLogLine = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\d [\d:.]+)\]\[(\d+)\]\[(\w+)\]\[([\w.-]+)\] (?:\[([^\]]+)\] )?(.*)$`)
+	// Connection [C123] and stream [S456] ids prefixing the message
+	connectionStreamIds = regexp.MustCompile(`^(?:\[C(\d+)\])?(?:\[S(\d+)\])?\s*`)
+)
+
+// parseLogRecord splits a log line into its fields
+func parseLogRecord(line string) logRecord {
+	if m := istioLogLine.FindStringSubmatch(line); m != nil {
+		record := logRecord{Time: m[1], Level: m[2]}
+		rest := m[3]
+
+		if strings.HasPrefix(rest, "envoy ") {
+			// envoy <logger> <source>\t<message>\tthread=<thread>
+			header, message, _ := strings.Cut(strings.TrimPrefix(rest, "envoy "), "\t")
+			record.Logger, record.Source, _ = strings.Cut(header, " ")
+			if i := strings.LastIndex(message, "\tthread="); i >= 0 {
+				record.Thread = message[i+len("\tthread="):]
+				message = message[:i]
+			}
+			rest = message
+		} else if scope, message, found := strings.Cut(rest, "\t"); found {
+			record.Logger = scope
+			rest = message
+		}
+
+		record.Connection, record.Stream, record.Message = splitConnectionStream(rest)
+		return record
+	}
+
+	if m := envoyLogLine.FindStringSubmatch(line); m != nil {
+		record := logRecord{
+			Time:   m[1],
+			Thread: m[2],
+			Level:  m[3],
+			Logger: m[4],
+			Source: m[5],
+		}
+		record.Connection, record.Stream, record.Message = splitConnectionStream(m[6])
+		return record
+	}
+
+	if entry, ok := parseAccessLog(line); ok {
+		return logRecord{Time: entry.StartTime, Message: line, AccessLog: entry}
+	}
+
+	return logRecord{Message: line}
+}
+
+func splitConnectionStream(message string) (string, string, string) {
+	m := connectionStreamIds.FindStringSubmatch(message)
+	return m[1], m[2], message[len(m[0]):]
+}
+
+// formatLogRecord renders the record as a single line of json or logfmt
+func formatLogRecord(record logRecord, output string) (string, error) {
+	switch output {
+	case "json":
+		data, err := json.Marshal(record)
+		return string(data), err
+	case "logfmt":
+		return logfmt(record), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %v", output)
+	}
+}
+
+type logfmtField struct {
+	key, value string
+}
+
+func logfmt(record logRecord) string {
+	var b strings.Builder
+	fields := []logfmtField{
+		{"time", record.Time},
+		{"level", record.Level},
+		{"pod", record.Pod},
+		{"namespace", record.Namespace},
+		{"container", record.Container},
+		{"logger", record.Logger},
+		{"source", record.Source},
+		{"thread", record.Thread},
+		{"connection", record.Connection},
+		{"stream", record.Stream},
+	}
+	if e := record.AccessLog; e != nil {
+		fields = append(fields, []logfmtField{
+			{"status", strconv.Itoa(e.ResponseCode)},
+			{"flags", e.ResponseFlags},
+			{"authority", e.Authority},
+			{"cluster", e.UpstreamCluster},
+			{"request_id", e.RequestID},
+		}...)
+	}
+	fields = append(fields, logfmtField{"msg", record.Message})
+
+	for _, field := range fields {
+		if field.value == "" && field.key != "msg" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(field.key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(field.value))
+	}
+	return b.String()
+}
+
+// logfmtValue quotes values that contain spaces, quotes or '='
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"=\\") || strconv.Quote(value) != `"`+value+`"` {
+		return strconv.Quote(value)
+	}
+	return value
+}
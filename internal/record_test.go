@@ -0,0 +1,103 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestParseLogRecord_A001(t *testing.T) {
+	line := "2023-08-01T10:00:00.123456Z\tdebug\tenvoy http external/envoy/source/common/http/conn_manager_impl.cc:329\t[C12][S3456] request end stream\tthread=21"
+
+	expected := logRecord{
+		Time:       "2023-08-01T10:00:00.123456Z",
+		Level:      "debug",
+		Logger:     "http",
+		Source:     "external/envoy/source/common/http/conn_manager_impl.cc:329",
+		Thread:     "21",
+		Connection: "12",
+		Stream:     "3456",
+		Message:    "request end stream",
+	}
+	if record := parseLogRecord(line); record != expected {
+		t.Errorf("Unexpected record %+v", record)
+	}
+}
+
+func TestParseLogRecord_A002(t *testing.T) {
+	line := "2023-08-01T10:00:00.123456Z\tinfo\txdsproxy\tconnected to upstream XDS server: istiod.istio-system.svc:15012"
+
+	expected := logRecord{
+		Time:    "2023-08-01T10:00:00.123456Z",
+		Level:   "info",
+		Logger:  "xdsproxy",
+		Message: "connected to upstream XDS server: istiod.istio-system.svc:15012",
+	}
+	if record := parseLogRecord(line); record != expected {
+		t.Errorf("Unexpected record %+v", record)
+	}
+}
+
+func TestParseLogRecord_A003(t *testing.T) {
+	line := "[2023-08-01 10:00:00.123][21][debug][router] [source/common/router/router.cc:470] [C12][S3456] cluster 'outbound|9080||reviews' match for URL '/reviews/0'"
+
+	expected := logRecord{
+		Time:       "2023-08-01 10:00:00.123",
+		Level:      "debug",
+		Logger:     "router",
+		Source:     "source/common/router/router.cc:470",
+		Thread:     "21",
+		Connection: "12",
+		Stream:     "3456",
+		Message:    "cluster 'outbound|9080||reviews' match for URL '/reviews/0'",
+	}
+	if record := parseLogRecord(line); record != expected {
+		t.Errorf("Unexpected record %+v", record)
+	}
+}
+
+func TestParseLogRecord_A004(t *testing.T) {
+	line := `[2023-08-01T10:00:00.123Z] "GET /reviews/0 HTTP/1.1" 200 - via_upstream`
+	if record := parseLogRecord(line); record != (logRecord{Message: line}) {
+		t.Errorf("Unknown line wasn't kept as message %+v", record)
+	}
+}
+
+func TestFormatLogRecord_A001(t *testing.T) {
+	record := logRecord{
+		Pod:        "reviews-1",
+		Time:       "2023-08-01T10:00:00.123456Z",
+		Level:      "debug",
+		Logger:     "http",
+		Connection: "12",
+		Message:    `request headers complete (end_stream=false)`,
+	}
+
+	text, err := formatLogRecord(record, "logfmt")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `time=2023-08-01T10:00:00.123456Z level=debug pod=reviews-1 logger=http connection=12 msg="request headers complete (end_stream=false)"`
+	if text != expected {
+		t.Errorf("Unexpected logfmt %v", text)
+	}
+
+	text, err = formatLogRecord(record, "json")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected = `{"pod":"reviews-1","time":"2023-08-01T10:00:00.123456Z","level":"debug","logger":"http","connection":"12","message":"request headers complete (end_stream=false)"}`
+	if text != expected {
+		t.Errorf("Unexpected json %v", text)
+	}
+}
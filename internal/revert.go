@@ -0,0 +1,179 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// A pod whose levels were raised for a limited time is labeled so it can be
+// found again, and annotated with the time the levels are due to be reverted
+// along with the levels to revert to. This lets `reap` revert them even when
+// the CLI that raised them never got to.
+const (
+	elevatedLabel            = "istiolog.tejabeta.github.io/elevated"
+	revertAtAnnotation       = "istiolog.tejabeta.github.io/revert-at"
+	originalLevelsAnnotation = "istiolog.tejabeta.github.io/original-levels"
+)
+
+// recordRevert records the revert time and the original levels on the pod
+func (opts *options) recordRevert(pod corev1.Pod, snapshot logSnapshot, revertAt time.Time) error {
+	levels, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return opts.patchRevert(pod, map[string]interface{}{
+		"labels": map[string]interface{}{
+			elevatedLabel: "true",
+		},
+		"annotations": map[string]interface{}{
+			revertAtAnnotation:       revertAt.UTC().Format(time.RFC3339),
+			originalLevelsAnnotation: string(levels),
+		},
+	})
+}
+
+// clearRevert removes the revert records from the pod
+func (opts *options) clearRevert(pod corev1.Pod) error {
+	return opts.patchRevert(pod, map[string]interface{}{
+		"labels": map[string]interface{}{
+			elevatedLabel: nil,
+		},
+		"annotations": map[string]interface{}{
+			revertAtAnnotation:       nil,
+			originalLevelsAnnotation: nil,
+		},
+	})
+}
+
+func (opts *options) patchRevert(pod corev1.Pod, metadata map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	_, err = opts.clientset.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// recordedSnapshot returns the original levels recorded on the pod, if any
+func recordedSnapshot(pod corev1.Pod) (logSnapshot, bool, error) {
+	levels, ok := pod.Annotations[originalLevelsAnnotation]
+	if !ok {
+		return nil, false, nil
+	}
+	var snapshot logSnapshot
+	if err := json.Unmarshal([]byte(levels), &snapshot); err != nil {
+		return nil, false, fmt.Errorf("invalid %v annotation on %v: %v", originalLevelsAnnotation, pod.Name, err)
+	}
+	return snapshot, true, nil
+}
+
+// originalSnapshot returns the levels to restore the pod to. When the levels
+// of the pod are already raised for a limited time, the levels recorded back
+// then are the original ones rather than the current ones.
+func originalSnapshot(pod corev1.Pod) (logSnapshot, error) {
+	snapshot, ok, err := recordedSnapshot(pod)
+	if err != nil || ok {
+		return snapshot, err
+	}
+	return podSnapshot(pod)
+}
+
+// restorePods restores every pod to its snapshot, keyed by namespace/name,
+// and clears the revert records left on them. The failures of every pod are
+// returned, as they leave levels raised.
+func (opts *options) restorePods(pods []corev1.Pod, snapshots map[string]logSnapshot, recorded bool) error {
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		if err := snapshots[pod.Namespace+"/"+pod.Name].restorePod(pod); err != nil {
+			errs[i] = fmt.Errorf("%v: failed to revert log levels: %v", pod.Name, err)
+			return
+		}
+		if _, ok := pod.Labels[elevatedLabel]; ok || recorded {
+			if err := opts.clearRevert(pod); err != nil {
+				errs[i] = fmt.Errorf("%v: %v", pod.Name, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// expiredPods returns the pods in every namespace whose levels were due to be
+// reverted before now.
+func (opts *options) expiredPods(now time.Time) ([]corev1.Pod, error) {
+	result, err := opts.clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: elevatedLabel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range result.Items {
+		revertAt, err := time.Parse(time.RFC3339, pod.Annotations[revertAtAnnotation])
+		if err != nil || !revertAt.After(now) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// KubectlIstioLogReap reverts the levels of every pod in the cluster whose
+// time-boxed levels expired.
+func (opts *options) KubectlIstioLogReap() error {
+	pods, err := opts.expiredPods(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		fmt.Println("No expired log levels found")
+		return nil
+	}
+
+	var errs []error
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "POD\tNAMESPACE\tREVERT AT\tRESULT")
+	for _, pod := range pods {
+		result := "reverted"
+		snapshot, _, err := recordedSnapshot(pod)
+		if err == nil && snapshot != nil {
+			err = snapshot.restorePod(pod)
+		}
+		if err == nil {
+			err = opts.clearRevert(pod)
+		}
+		if err != nil {
+			result = err.Error()
+			errs = append(errs, fmt.Errorf("%v: %v", pod.Name, err))
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", pod.Name, pod.Namespace, pod.Annotations[revertAtAnnotation], result)
+	}
+	w.Flush()
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{fmt.Errorf("failed to revert log levels of %d of %d pods", len(errs), len(pods))}, errs...)...)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/kube"
+	appv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestRecordRevert_A001(t *testing.T) {
+	pod := newTestPod("reviews-1", map[string]string{"app": "reviews"}, "app", istioContainer)
+	options := newTestOptions(t, pod)
+
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := options.recordRevert(*pod, snapshot, time.Now().Add(10*time.Minute)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	recorded, err := options.clientset.CoreV1().Pods(options.namespace).Get(context.TODO(), "reviews-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if recorded.Labels[elevatedLabel] != "true" || recorded.Labels["app"] != "reviews" {
+		t.Errorf("Unexpected labels %v", recorded.Labels)
+	}
+	original, err := originalSnapshot(*recorded)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(original, snapshot) {
+		t.Errorf("Recorded levels %v, expected %v", original, snapshot)
+	}
+
+	if err := options.clearRevert(*recorded); err != nil {
+		t.Fatal(err.Error())
+	}
+	cleared, err := options.clientset.CoreV1().Pods(options.namespace).Get(context.TODO(), "reviews-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := cleared.Labels[elevatedLabel]; ok || len(cleared.Annotations) != 0 {
+		t.Errorf("Revert records left on the pod %v %v", cleared.Labels, cleared.Annotations)
+	}
+}
+
+func TestExpiredPods_A001(t *testing.T) {
+	now := time.Now()
+	expired := newTestPod("reviews-1", map[string]string{elevatedLabel: "true"}, istioContainer)
+	expired.Annotations = map[string]string{revertAtAnnotation: now.Add(-time.Minute).Format(time.RFC3339)}
+	pending := newTestPod("reviews-2", map[string]string{elevatedLabel: "true"}, istioContainer)
+	pending.Annotations = map[string]string{revertAtAnnotation: now.Add(time.Minute).Format(time.RFC3339)}
+	untouched := newTestPod("reviews-3", nil, istioContainer)
+	options := newTestOptions(t, expired, pending, untouched)
+
+	pods, err := options.expiredPods(now)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pods) != 1 || pods[0].Name != "reviews-1" {
+		t.Errorf("Expected only reviews-1 to be expired, got %v", pods)
+	}
+}
+
+// unreachableProxies makes every admin request of the test fail
+func unreachableProxies(t *testing.T) {
+	previous := kubeClient
+	kubeClient = func(clientcmd.ClientConfig) (kube.CLIClient, error) {
+		return nil, errors.New("cluster unreachable")
+	}
+	CloseConnections()
+	adminConns.client = nil
+	t.Cleanup(func() {
+		kubeClient = previous
+		CloseConnections()
+		adminConns.client = nil
+	})
+}
+
+func TestRestorePods_A001(t *testing.T) {
+	unreachableProxies(t)
+	pods := []*appv1.Pod{
+		newTestPod("reviews-1", nil, istioContainer),
+		newTestPod("reviews-2", nil, istioContainer),
+	}
+	options := newTestOptions(t, pods...)
+
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	snapshots := map[string]logSnapshot{"unit-test-namespace/reviews-1": snapshot, "unit-test-namespace/reviews-2": snapshot}
+
+	// Levels left raised on any pod fail the command
+	err = options.restorePods([]appv1.Pod{*pods[0], *pods[1]}, snapshots, false)
+	if err == nil {
+		t.Fatal("Expected failed reverts to be returned")
+	}
+	for _, pod := range []string{"reviews-1", "reviews-2"} {
+		if !strings.Contains(err.Error(), pod+": failed to revert log levels") {
+			t.Errorf("Expected the failure of %v in %q", pod, err.Error())
+		}
+	}
+}
+
+func TestRestorePods_A002(t *testing.T) {
+	// Replicas of the same name in two namespaces, as listed across
+	// namespaces
+	bookinfo := newTestPod("reviews-1", nil, istioContainer)
+	bookinfo.Namespace = "bookinfo"
+	staging := newTestPod("reviews-1", nil, istioContainer)
+	staging.Namespace = "staging"
+	options := newTestOptions(t)
+
+	var mu sync.Mutex
+	restored := map[string][]string{}
+	for _, namespace := range []string{"bookinfo", "staging"} {
+		namespace := namespace
+		testProxy(t, "reviews-1", namespace, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			restored[namespace] = append(restored[namespace], r.URL.RawQuery)
+			mu.Unlock()
+		})
+	}
+
+	bookinfoLevels, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	stagingLevels, err := parseLogSnapshot("active loggers:\n  http: trace\n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	snapshots := map[string]logSnapshot{"bookinfo/reviews-1": bookinfoLevels, "staging/reviews-1": stagingLevels}
+	if err := options.restorePods([]appv1.Pod{*bookinfo, *staging}, snapshots, false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Every pod is restored to its own levels
+	if !reflect.DeepEqual(restored["bookinfo"], bookinfoLevels.restoreParams()) {
+		t.Errorf("Unexpected restore of bookinfo/reviews-1 %q", restored["bookinfo"])
+	}
+	if !reflect.DeepEqual(restored["staging"], stagingLevels.restoreParams()) {
+		t.Errorf("Unexpected restore of staging/reviews-1 %q", restored["staging"])
+	}
+}
+
+func TestKubectlIstioLogReap_A001(t *testing.T) {
+	unreachableProxies(t)
+	pod := newTestPod("reviews-1", nil, istioContainer)
+	options := newTestOptions(t, pod)
+
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := options.recordRevert(*pod, snapshot, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = options.KubectlIstioLogReap()
+	if err == nil || !strings.Contains(err.Error(), "failed to revert log levels of 1 of 1 pods") || !strings.Contains(err.Error(), "reviews-1: ") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// loggerLevel is the level of a single Envoy logger
+type loggerLevel struct {
+	Name  string `json:"name"`
+	Level Level  `json:"level"`
+}
+
+// logSnapshot holds the levels of every logger of a proxy, in the order
+// reported by Envoy, so they can be restored later on.
+type logSnapshot []loggerLevel
+
+// getLogSnapshot reads the active loggers of the pod's proxy. Envoy only
+// accepts POST on the logging endpoint, without parameters it changes
+// nothing and lists the current levels.
+func getLogSnapshot(pod, namespace string) (logSnapshot, error) {
+	resp, err := setupEnvoyLog("", pod, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseLogSnapshot(resp)
+}
+
+// lazySnapshot returns a function reading the active loggers of the pod's
+// proxy on its first call only, so validating logger names and resetting
+// loggers share a single request
+func lazySnapshot(pod, namespace string) func() (logSnapshot, error) {
+	var once sync.Once
+	var snapshot logSnapshot
+	var err error
+	return func() (logSnapshot, error) {
+		once.Do(func() { snapshot, err = getLogSnapshot(pod, namespace) })
+		return snapshot, err
+	}
+}
+
+// parseLogSnapshot parses Envoy's logging response:
+//
+//	active loggers:
+//	  admin: warning
+//	  http: debug
+func parseLogSnapshot(resp string) (logSnapshot, error) {
+	var snapshot logSnapshot
+
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		nameLevel := strings.SplitN(line, ":", 2)
+		if len(nameLevel) != 2 {
+			return nil, fmt.Errorf("unexpected line in Envoy logging response: %q", line)
+		}
+		level, ok := stringToLevel[strings.TrimSpace(nameLevel[1])]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized logging level in Envoy logging response: %q", line)
+		}
+		snapshot = append(snapshot, loggerLevel{
+			Name:  strings.TrimSpace(nameLevel[0]),
+			Level: level,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(snapshot) == 0 {
+		return nil, fmt.Errorf("no active loggers in Envoy logging response")
+	}
+	return snapshot, nil
+}
+
+// commonLevel returns the level shared by most loggers
+func (s logSnapshot) commonLevel() Level {
+	counts := map[Level]int{}
+	for _, ll := range s {
+		counts[ll.Level]++
+	}
+	common := defaultOutputLevel
+	for level, count := range counts {
+		if count > counts[common] || (count == counts[common] && level > common) {
+			common = level
+		}
+	}
+	return common
+}
+
+// defaultLevel returns the level of the level logger, which ztunnel
+// reports, or else the level shared by most loggers
+func (s logSnapshot) defaultLevel() Level {
+	for _, ll := range s {
+		if ll.Name == defaultLoggerName {
+			return ll.Level
+		}
+	}
+	return s.commonLevel()
+}
+
+// levels returns the level of every logger by name
+func (s logSnapshot) levels() map[string]Level {
+	levels := make(map[string]Level, len(s))
+	for _, ll := range s {
+		levels[ll.Name] = ll.Level
+	}
+	return levels
+}
+
+// overrides returns the loggers whose level differs from the given one
+func (s logSnapshot) overrides(level Level) logSnapshot {
+	var overrides logSnapshot
+	for _, ll := range s {
+		if ll.Level != level {
+			overrides = append(overrides, ll)
+		}
+	}
+	return overrides
+}
+
+// restoreParams returns the logging requests restoring the snapshot: the
+// level shared by most loggers is set on all of them first, then the
+// remaining loggers at once.
+func (s logSnapshot) restoreParams() []string {
+	common := s.commonLevel()
+	return envoyLogParams(append(logSnapshot{{Name: defaultLoggerName, Level: common}}, s.overrides(common)...))
+}
+
+// restore sets every logger of the pod's proxy back to its snapshot level
+func (s logSnapshot) restore(pod, namespace string) error {
+	for _, param := range s.restoreParams() {
+		if _, err := setupEnvoyLog(param, pod, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
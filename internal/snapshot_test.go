@@ -0,0 +1,84 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testLoggingResponse = `active loggers:
+  admin: warning
+  connection: info
+  http: debug
+  rbac: info
+  router: info
+  upstream: warning
+`
+
+func TestParseLogSnapshot_A001(t *testing.T) {
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := logSnapshot{
+		{Name: "admin", Level: WarningLevel},
+		{Name: "connection", Level: InfoLevel},
+		{Name: "http", Level: DebugLevel},
+		{Name: "rbac", Level: InfoLevel},
+		{Name: "router", Level: InfoLevel},
+		{Name: "upstream", Level: WarningLevel},
+	}
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+}
+
+func TestParseLogSnapshot_A002(t *testing.T) {
+	if _, err := parseLogSnapshot("active loggers:\n  admin: verbose\n"); err == nil {
+		t.Errorf("Error while parsing illegal loggerLevel")
+	}
+	if _, err := parseLogSnapshot(""); err == nil {
+		t.Errorf("Error while parsing an empty response")
+	}
+}
+
+func TestRestoreParams_A001(t *testing.T) {
+	snapshot, err := parseLogSnapshot(testLoggingResponse)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []string{"level=info", "paths=admin:warning,http:debug,upstream:warning"}
+	if params := snapshot.restoreParams(); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Unexpected restore params %v", params)
+	}
+}
+
+func TestRestoreParams_A002(t *testing.T) {
+	snapshot, err := parseLogSnapshot(`active loggers:
+  source/common/http/conn_manager_impl.cc: info
+  source/common/router/router.cc: debug
+  source/common/upstream/cluster_manager_impl.cc: info
+  source/server/server.cc: warning
+`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []string{"level=info", "paths=source/common/router/router.cc:debug,source/server/server.cc:warning"}
+	if params := snapshot.restoreParams(); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Unexpected restore params %v", params)
+	}
+}
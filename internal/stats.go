@@ -0,0 +1,161 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// counters are the values of the Envoy counters of a proxy by name
+type counters map[string]uint64
+
+// counterDelta is the increase of a counter of a pod over a session
+type counterDelta struct {
+	Pod   string
+	Name  string
+	Delta uint64
+}
+
+// getCounters reads the counters of the pod's Envoy
+func getCounters(pod corev1.Pod) (counters, error) {
+	resp, err := envoyAdmin("GET", "stats?type=Counters", pod.Name, pod.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseCounters(string(resp)), nil
+}
+
+// parseCounters parses the text stats of Envoy, one "name: value" per line.
+// Gauges and histograms listed by Envoy versions ignoring the type filter
+// are kept or skipped alike: only integer values are retained.
+func parseCounters(resp string) counters {
+	result := counters{}
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	scanner.Buffer(make([]byte, readBufferSize), maxLineSize)
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), ": ")
+		if !found {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			result[name] = n
+		}
+	}
+	return result
+}
+
+// statsSnapshot reads the counters of every Envoy among the pods, keyed by
+// namespace/name, reporting the ones that can't be read
+func statsSnapshot(pods []corev1.Pod) map[string]counters {
+	list := make([]counters, len(pods))
+	errs := make([]error, len(pods))
+	forEachPod(pods, func(i int, pod corev1.Pod) {
+		if !isZtunnel(pod) && !isIstiod(pod) {
+			list[i], errs[i] = getCounters(pod)
+		}
+	})
+
+	snapshot := map[string]counters{}
+	for i, pod := range pods {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "%v: failed to read stats: %v\n", pod.Name, errs[i])
+			continue
+		}
+		if list[i] != nil {
+			snapshot[pod.Namespace+"/"+pod.Name] = list[i]
+		}
+	}
+	return snapshot
+}
+
+// counterDeltas returns the counters of the pod that increased, counters that
+// went down having been reset by a restart
+func counterDeltas(pod string, before, after counters) []counterDelta {
+	var deltas []counterDelta
+	for name, value := range after {
+		if value > before[name] {
+			deltas = append(deltas, counterDelta{Pod: pod, Name: name, Delta: value - before[name]})
+		}
+	}
+	return deltas
+}
+
+// printStatsDiff reads the counters of the pods again and prints the ones
+// that increased since the snapshot, largest increase first. Pods whose
+// counters couldn't be read either time are listed, as nothing is known of
+// them.
+func printStatsDiff(out io.Writer, pods []corev1.Pod, before map[string]counters) {
+	after := statsSnapshot(pods)
+	var deltas []counterDelta
+	var missing []string
+	compared := 0
+	for _, pod := range pods {
+		if isZtunnel(pod) || isIstiod(pod) {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		stats, ok := before[key]
+		current, found := after[key]
+		if !ok || !found {
+			missing = append(missing, pod.Name)
+			continue
+		}
+		compared++
+		deltas = append(deltas, counterDeltas(pod.Name, stats, current)...)
+	}
+
+	if len(missing) > 0 {
+		fmt.Fprintf(out, "Counters not compared, failed to read them: %v\n", strings.Join(missing, ", "))
+	}
+	if compared == 0 {
+		if len(missing) == 0 {
+			fmt.Fprintln(out, "No Envoy counters to compare")
+		}
+		return
+	}
+	printCounterDeltas(out, deltas)
+}
+
+func printCounterDeltas(out io.Writer, deltas []counterDelta) {
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Delta != deltas[j].Delta {
+			return deltas[i].Delta > deltas[j].Delta
+		}
+		if deltas[i].Pod != deltas[j].Pod {
+			return deltas[i].Pod < deltas[j].Pod
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+
+	if len(deltas) == 0 {
+		fmt.Fprintln(out, "No counter changed")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "POD\tCOUNTER\tDELTA")
+	for _, d := range deltas {
+		fmt.Fprintf(w, "%v\t%v\t+%d\n", d.Pod, d.Name, d.Delta)
+	}
+	w.Flush()
+}
@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	appv1 "k8s.io/api/core/v1"
+)
+
+func TestParseCounters_A001(t *testing.T) {
+	stats := parseCounters(`cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_rq_5xx: 12
+cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_cx_connect_fail: 3
+http.inbound_0.0.0.0_9080.rbac.denied: 0
+cluster.xds-grpc.upstream_rq_time: P0(nan,1.0) P25(nan,1.025)
+`)
+	if len(stats) != 3 {
+		t.Fatalf("Expected the 3 counters only, got %v", stats)
+	}
+	if stats["cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_rq_5xx"] != 12 {
+		t.Errorf("Unexpected counters %v", stats)
+	}
+}
+
+func TestCounterDeltas_A001(t *testing.T) {
+	before := counters{"upstream_rq_5xx": 10, "ssl.handshake_error": 1, "rbac.denied": 4, "restarted": 100}
+	after := counters{"upstream_rq_5xx": 42, "ssl.handshake_error": 3, "rbac.denied": 4, "restarted": 2, "cx_connect_fail": 2}
+
+	deltas := counterDeltas("reviews-1", before, after)
+	deltas = append(deltas, counterDeltas("ratings-1", counters{"upstream_rq_5xx": 0}, counters{"upstream_rq_5xx": 2})...)
+
+	var out bytes.Buffer
+	printCounterDeltas(&out, deltas)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var rows []string
+	for _, line := range lines[1:] {
+		rows = append(rows, strings.Join(strings.Fields(line), " "))
+	}
+	expected := []string{
+		"reviews-1 upstream_rq_5xx +32",
+		"ratings-1 upstream_rq_5xx +2",
+		"reviews-1 cx_connect_fail +2",
+		"reviews-1 ssl.handshake_error +2",
+	}
+	if strings.Join(rows, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected rows %q", rows)
+	}
+
+	out.Reset()
+	printCounterDeltas(&out, nil)
+	if out.String() != "No counter changed\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+func TestStatsSnapshot_A001(t *testing.T) {
+	// Replicas of the same name in two namespaces, as listed across
+	// namespaces
+	var pods []appv1.Pod
+	for i, namespace := range []string{"bookinfo", "staging"} {
+		pod := newTestPod("reviews-1", nil, istioContainer)
+		pod.Namespace = namespace
+		pods = append(pods, *pod)
+		resp := fmt.Sprintf("upstream_rq_5xx: %d\n", i+1)
+		testProxy(t, "reviews-1", namespace, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, resp)
+		})
+	}
+
+	snapshot := statsSnapshot(pods)
+	if snapshot["bookinfo/reviews-1"]["upstream_rq_5xx"] != 1 || snapshot["staging/reviews-1"]["upstream_rq_5xx"] != 2 {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+}
+
+func TestPrintStatsDiff_A001(t *testing.T) {
+	unreachableProxies(t)
+	pods := []appv1.Pod{
+		*newTestPod("reviews-1", nil, istioContainer),
+		*newTestPod("reviews-2", nil, istioContainer),
+	}
+	testProxy(t, "reviews-1", "unit-test-namespace", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream_rq_5xx: 1\n")
+	})
+	before := map[string]counters{
+		"unit-test-namespace/reviews-1": {"upstream_rq_5xx": 1},
+		"unit-test-namespace/reviews-2": {"upstream_rq_5xx": 1},
+	}
+
+	// The counters of reviews-2 can't be read again
+	var out bytes.Buffer
+	printStatsDiff(&out, pods, before)
+	expected := "Counters not compared, failed to read them: reviews-2\nNo counter changed\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// Nothing changed can't be told when nothing was compared
+	out.Reset()
+	printStatsDiff(&out, pods[1:], before)
+	expected = "Counters not compared, failed to read them: reviews-2\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
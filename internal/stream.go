@@ -0,0 +1,140 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI colors used to tell pods apart in merged streams
+var podColors = []string{
+	"\033[31m", // red
+	"\033[32m", // green
+	"\033[33m", // yellow
+	"\033[34m", // blue
+	"\033[35m", // magenta
+	"\033[36m", // cyan
+	"\033[91m", // bright red
+	"\033[92m", // bright green
+	"\033[93m", // bright yellow
+	"\033[94m", // bright blue
+	"\033[95m", // bright magenta
+	"\033[96m", // bright cyan
+}
+
+const colorReset = "\033[0m"
+
+const (
+	// maxLineSize bounds the length of a single log line, longer lines are
+	// truncated
+	maxLineSize    = 1024 * 1024
+	readBufferSize = 64 * 1024
+
+	truncatedSuffix = " [truncated]"
+)
+
+// lineWriter writes whole lines of several streams to out, so lines of
+// different pods never interleave.
+type lineWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *lineWriter) writeLine(prefix, line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := fmt.Fprintf(w.out, "%v%v\n", prefix, line)
+	return err
+}
+
+// podPrefix returns the [pod/container] prefix of a pod's lines, colored
+// with a color derived from the pod name so it stays the same across runs.
+func podPrefix(pod, container string, color bool) string {
+	prefix := "[" + pod + "/" + container + "]"
+	if !color {
+		return prefix + " "
+	}
+	h := fnv.New32a()
+	h.Write([]byte(pod))
+	return podColors[h.Sum32()%uint32(len(podColors))] + prefix + colorReset + " "
+}
+
+// useColor reports whether the output is a terminal that wants colors
+func useColor(out *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return term.IsTerminal(int(out.Fd()))
+}
+
+// readLines reads r line by line until EOF, handing each line without its
+// line ending to handle. Reads block until data is available, so an idle
+// stream doesn't consume CPU. Lines longer than maxSize are truncated on a
+// rune boundary and the rest of the line is dropped, which bounds the memory
+// used by a single line.
+func readLines(r io.Reader, maxSize int, handle func(line string) error) error {
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	var line []byte
+	truncated := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !truncated {
+			line = append(line, chunk...)
+			if len(line) > maxSize {
+				line = truncateLine(line, maxSize)
+				truncated = true
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(line) > 0 || err == nil {
+			text := strings.TrimRight(string(line), "\r\n")
+			if truncated {
+				text += truncatedSuffix
+			}
+			if herr := handle(text); herr != nil {
+				return herr
+			}
+		}
+		line = line[:0]
+		truncated = false
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// truncateLine cuts line to at most size bytes without splitting a rune
+func truncateLine(line []byte, size int) []byte {
+	for size > 0 && !utf8.RuneStart(line[size]) {
+		size--
+	}
+	return line[:size]
+}
@@ -0,0 +1,70 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPodPrefix_A001(t *testing.T) {
+	prefix := podPrefix("reviews-1", istioContainer, true)
+	if prefix != podPrefix("reviews-1", istioContainer, true) {
+		t.Errorf("Color of a pod isn't stable")
+	}
+	if !strings.HasPrefix(prefix, "\033[") || !strings.Contains(prefix, "[reviews-1/istio-proxy]"+colorReset) {
+		t.Errorf("Unexpected colored prefix %q", prefix)
+	}
+}
+
+func readAllLines(t *testing.T, input string, maxSize int) []string {
+	var lines []string
+	err := readLines(strings.NewReader(input), maxSize, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return lines
+}
+
+func TestReadLines_A001(t *testing.T) {
+	lines := readAllLines(t, "first\r\nsecond\n\nlast without newline", 64)
+	expected := []string{"first", "second", "", "last without newline"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected lines %q", lines)
+	}
+}
+
+func TestReadLines_A002(t *testing.T) {
+	long := strings.Repeat("a", readBufferSize*3)
+	lines := readAllLines(t, long+"\nnext\n", readBufferSize)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0] != long[:readBufferSize]+truncatedSuffix {
+		t.Errorf("Long line wasn't truncated to the max line size")
+	}
+	if lines[1] != "next" {
+		t.Errorf("Line following a truncated line is %q", lines[1])
+	}
+}
+
+func TestReadLines_A003(t *testing.T) {
+	// "é" is two bytes long, the limit falls in its middle
+	lines := readAllLines(t, "abé\n", 3)
+	if len(lines) != 1 || lines[0] != "ab"+truncatedSuffix {
+		t.Errorf("Unexpected truncation of a multi-byte rune %q", lines)
+	}
+}